@@ -0,0 +1,5 @@
+// Package mailverifierv1 contains the gRPC API of mailverifier generated
+// from mailverifier.proto.
+package mailverifierv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative mailverifier/v1/mailverifier.proto
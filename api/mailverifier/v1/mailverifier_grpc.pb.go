@@ -0,0 +1,323 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package mailverifierv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MailVerifierServiceClient is the client API for MailVerifierService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MailVerifierServiceClient interface {
+	CreatePlayer(ctx context.Context, in *CreatePlayerRequest, opts ...grpc.CallOption) (*Player, error)
+	GetPlayer(ctx context.Context, in *GetPlayerRequest, opts ...grpc.CallOption) (*Player, error)
+	ListPlayers(ctx context.Context, in *ListPlayersRequest, opts ...grpc.CallOption) (*ListPlayersResponse, error)
+	CreateVerification(ctx context.Context, in *CreateVerificationRequest, opts ...grpc.CallOption) (*Verification, error)
+	ListVerifications(ctx context.Context, in *ListVerificationsRequest, opts ...grpc.CallOption) (*ListVerificationsResponse, error)
+	// SendVerificationEmail sends a code to the email address. A new
+	// verification is started if the latest one is closed.
+	SendVerificationEmail(ctx context.Context, in *SendVerificationEmailRequest, opts ...grpc.CallOption) (*VerificationEmail, error)
+	// Verify completes the latest verification of the player with a code.
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Verification, error)
+}
+
+type mailVerifierServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMailVerifierServiceClient(cc grpc.ClientConnInterface) MailVerifierServiceClient {
+	return &mailVerifierServiceClient{cc}
+}
+
+func (c *mailVerifierServiceClient) CreatePlayer(ctx context.Context, in *CreatePlayerRequest, opts ...grpc.CallOption) (*Player, error) {
+	out := new(Player)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/CreatePlayer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) GetPlayer(ctx context.Context, in *GetPlayerRequest, opts ...grpc.CallOption) (*Player, error) {
+	out := new(Player)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/GetPlayer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) ListPlayers(ctx context.Context, in *ListPlayersRequest, opts ...grpc.CallOption) (*ListPlayersResponse, error) {
+	out := new(ListPlayersResponse)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/ListPlayers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) CreateVerification(ctx context.Context, in *CreateVerificationRequest, opts ...grpc.CallOption) (*Verification, error) {
+	out := new(Verification)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/CreateVerification", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) ListVerifications(ctx context.Context, in *ListVerificationsRequest, opts ...grpc.CallOption) (*ListVerificationsResponse, error) {
+	out := new(ListVerificationsResponse)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/ListVerifications", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) SendVerificationEmail(ctx context.Context, in *SendVerificationEmailRequest, opts ...grpc.CallOption) (*VerificationEmail, error) {
+	out := new(VerificationEmail)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/SendVerificationEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mailVerifierServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Verification, error) {
+	out := new(Verification)
+	err := c.cc.Invoke(ctx, "/mailverifier.v1.MailVerifierService/Verify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MailVerifierServiceServer is the server API for MailVerifierService service.
+// All implementations must embed UnimplementedMailVerifierServiceServer
+// for forward compatibility
+type MailVerifierServiceServer interface {
+	CreatePlayer(context.Context, *CreatePlayerRequest) (*Player, error)
+	GetPlayer(context.Context, *GetPlayerRequest) (*Player, error)
+	ListPlayers(context.Context, *ListPlayersRequest) (*ListPlayersResponse, error)
+	CreateVerification(context.Context, *CreateVerificationRequest) (*Verification, error)
+	ListVerifications(context.Context, *ListVerificationsRequest) (*ListVerificationsResponse, error)
+	// SendVerificationEmail sends a code to the email address. A new
+	// verification is started if the latest one is closed.
+	SendVerificationEmail(context.Context, *SendVerificationEmailRequest) (*VerificationEmail, error)
+	// Verify completes the latest verification of the player with a code.
+	Verify(context.Context, *VerifyRequest) (*Verification, error)
+	mustEmbedUnimplementedMailVerifierServiceServer()
+}
+
+// UnimplementedMailVerifierServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMailVerifierServiceServer struct {
+}
+
+func (UnimplementedMailVerifierServiceServer) CreatePlayer(context.Context, *CreatePlayerRequest) (*Player, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreatePlayer not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) GetPlayer(context.Context, *GetPlayerRequest) (*Player, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlayer not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) ListPlayers(context.Context, *ListPlayersRequest) (*ListPlayersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPlayers not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) CreateVerification(context.Context, *CreateVerificationRequest) (*Verification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateVerification not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) ListVerifications(context.Context, *ListVerificationsRequest) (*ListVerificationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVerifications not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) SendVerificationEmail(context.Context, *SendVerificationEmailRequest) (*VerificationEmail, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendVerificationEmail not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) Verify(context.Context, *VerifyRequest) (*Verification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedMailVerifierServiceServer) mustEmbedUnimplementedMailVerifierServiceServer() {}
+
+// UnsafeMailVerifierServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MailVerifierServiceServer will
+// result in compilation errors.
+type UnsafeMailVerifierServiceServer interface {
+	mustEmbedUnimplementedMailVerifierServiceServer()
+}
+
+func RegisterMailVerifierServiceServer(s grpc.ServiceRegistrar, srv MailVerifierServiceServer) {
+	s.RegisterService(&MailVerifierService_ServiceDesc, srv)
+}
+
+func _MailVerifierService_CreatePlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).CreatePlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/CreatePlayer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).CreatePlayer(ctx, req.(*CreatePlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_GetPlayer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).GetPlayer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/GetPlayer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).GetPlayer(ctx, req.(*GetPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_ListPlayers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPlayersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).ListPlayers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/ListPlayers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).ListPlayers(ctx, req.(*ListPlayersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_CreateVerification_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateVerificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).CreateVerification(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/CreateVerification",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).CreateVerification(ctx, req.(*CreateVerificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_ListVerifications_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVerificationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).ListVerifications(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/ListVerifications",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).ListVerifications(ctx, req.(*ListVerificationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_SendVerificationEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendVerificationEmailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).SendVerificationEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/SendVerificationEmail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).SendVerificationEmail(ctx, req.(*SendVerificationEmailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MailVerifierService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MailVerifierServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mailverifier.v1.MailVerifierService/Verify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MailVerifierServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MailVerifierService_ServiceDesc is the grpc.ServiceDesc for MailVerifierService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MailVerifierService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mailverifier.v1.MailVerifierService",
+	HandlerType: (*MailVerifierServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreatePlayer",
+			Handler:    _MailVerifierService_CreatePlayer_Handler,
+		},
+		{
+			MethodName: "GetPlayer",
+			Handler:    _MailVerifierService_GetPlayer_Handler,
+		},
+		{
+			MethodName: "ListPlayers",
+			Handler:    _MailVerifierService_ListPlayers_Handler,
+		},
+		{
+			MethodName: "CreateVerification",
+			Handler:    _MailVerifierService_CreateVerification_Handler,
+		},
+		{
+			MethodName: "ListVerifications",
+			Handler:    _MailVerifierService_ListVerifications_Handler,
+		},
+		{
+			MethodName: "SendVerificationEmail",
+			Handler:    _MailVerifierService_SendVerificationEmail_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _MailVerifierService_Verify_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "mailverifier/v1/mailverifier.proto",
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/db"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/mailverifier"
+	"github.com/hhn-mc/mailverifier/internal/player"
+	"github.com/hhn-mc/mailverifier/internal/webhook"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// adminEnv is the environment shared by the administrative commands.
+type adminEnv struct {
+	cfg  mailverifier.Config
+	db   *db.DB
+	mail *mailer.Service
+	svc  *player.Service
+}
+
+// openAdminEnv loads the config and connects to the database the same
+// way serve does, so the commands apply the same business rules.
+func openAdminEnv(configPath string) *adminEnv {
+	cfg, err := mailverifier.LoadConfig(configPath)
+	if err != nil {
+		fatalf("Failed loading config from %s; %s", configPath, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatalf("Config %s is invalid; %s", configPath, err)
+	}
+
+	logCfg := loggingConfig(cfg)
+	logCfg.Format = logging.FormatConsole
+	logCfg.Level = "warn"
+	if err := logging.Setup(logCfg); err != nil {
+		fatalf("Failed setting up logging; %s", err)
+	}
+
+	db := newDB(cfg)
+	if err := db.Open(); err != nil {
+		fatalf("Failed connecting to the database; %s", err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		fatalf("Failed migrating the database schema; %s", err)
+	}
+
+	veCfg, err := verificationEmailConfig(cfg)
+	if err != nil {
+		fatalf("Failed parsing verification email config; %s", err)
+	}
+	db.VerificationValidity = func() time.Duration { return verificationValidity(veCfg) }
+
+	webhookCfg, err := webhookConfig(cfg)
+	if err != nil {
+		fatalf("Failed parsing webhook config; %s", err)
+	}
+
+	mailCfg, err := mailerConfig(cfg)
+	if err != nil {
+		fatalf("Failed parsing email config; %s", err)
+	}
+	mail, err := mailer.NewService(mailCfg)
+	if err != nil {
+		fatalf("Failed loading email templates; %s", err)
+	}
+
+	return &adminEnv{
+		cfg:  cfg,
+		db:   &db,
+		mail: mail,
+		svc: &player.Service{
+			Repo:   &db,
+			Mailer: mail,
+			Audit:  &audit.Log{Repo: &db},
+			Config: func() player.VerificationEmailConfig { return veCfg },
+			// Deliveries are queued in the database and sent by serve.
+			Webhooks: webhook.NewDispatcher(&db, webhookCfg),
+			// Events only reach the streams of serve through Postgres.
+			Events: eventBus(cfg, &db),
+		},
+	}
+}
+
+// context returns the context for the actions of a command. They are
+// attributed to the user running it.
+func (env *adminEnv) context() context.Context {
+	name := "cli"
+	if u, err := user.Current(); err == nil {
+		name += ":" + u.Username
+	}
+	return auth.WithIdentity(context.Background(), auth.Identity{
+		Name:   name,
+		Scopes: []string{auth.ScopeAdmin},
+	})
+}
+
+func (env *adminEnv) Close() {
+	env.mail.Close()
+	env.db.Close()
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", outputTable, "output format, table or json")
+}
+
+// parseWithUUID parses the flags and the player UUID, which may be given
+// before or after the flags.
+func parseWithUUID(fs *flag.FlagSet, args []string) string {
+	var uuid string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		uuid, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if uuid == "" {
+		uuid = fs.Arg(0)
+	}
+
+	if err := validation.Validate(uuid, validation.Required, is.UUIDv4); err != nil {
+		fatalf("Invalid player UUID %q; %s", uuid, err)
+	}
+	return uuid
+}
+
+// printOutput writes v as JSON or calls table with a tabwriter.
+func printOutput(format string, v interface{}, table func(w io.Writer)) {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			fatalf("Failed encoding output; %s", err)
+		}
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		w.Flush()
+	default:
+		fatalf("Unknown output format %q", format)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/mailverifier"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `Usage: mailverifier config <init|check|print> [flags]
+`
+
+func configCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "init":
+		configInit(args[1:])
+	case "check":
+		configCheck(args[1:])
+	case "print":
+		configPrint(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command %q\n\n%s", args[0], configUsage)
+		os.Exit(2)
+	}
+}
+
+func configInit(args []string) {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	configPath := configFlag(fs)
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Parse(args)
+
+	if err := mailverifier.WriteDefaultConfig(*configPath, *force); err != nil {
+		fatalf("Failed writing default config; %s", err)
+	}
+	fmt.Printf("Wrote default config to %s\n", *configPath)
+}
+
+func configCheck(args []string) {
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configPath := configFlag(fs)
+	online := fs.Bool("online", false, "also check that the database and SMTP server are reachable")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the online checks")
+	fs.Parse(args)
+
+	cfg, err := mailverifier.LoadConfig(*configPath)
+	if err != nil {
+		fatalf("Failed loading config from %s; %s", *configPath, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatalf("Config %s is invalid; %s", *configPath, err)
+	}
+	fmt.Printf("Config %s is valid\n", *configPath)
+
+	if !*online {
+		return
+	}
+
+	failed := false
+	db := newDB(cfg)
+	db.Timeout = *timeout
+	if err := db.Open(); err != nil {
+		fmt.Printf("Database %s: %s\n", cfg.Database.Host, err)
+		failed = true
+	} else {
+		db.Close()
+		fmt.Printf("Database %s: ok\n", cfg.Database.Host)
+	}
+
+	mailCfg, err := mailerConfig(cfg)
+	if err != nil {
+		fatalf("Failed parsing email config; %s", err)
+	}
+	mail, err := mailer.NewService(mailCfg)
+	if err != nil {
+		fatalf("Failed loading email templates; %s", err)
+	}
+	if err := mail.Check(*timeout); err != nil {
+		fmt.Printf("SMTP server %s: %s\n", cfg.Email.SMTPHost, err)
+		failed = true
+	} else {
+		fmt.Printf("SMTP server %s: ok\n", cfg.Email.SMTPHost)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func configPrint(args []string) {
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	configPath := configFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := mailverifier.LoadConfig(*configPath)
+	if err != nil {
+		fatalf("Failed loading config from %s; %s", *configPath, err)
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg.Masked()); err != nil {
+		fatalf("Failed encoding config; %s", err)
+	}
+}
+
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
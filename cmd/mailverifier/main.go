@@ -1,22 +1,64 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"flag"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hhn-mc/mailverifier/internal/auth"
 	"github.com/hhn-mc/mailverifier/internal/db"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/logging"
 	"github.com/hhn-mc/mailverifier/internal/mailer"
 	"github.com/hhn-mc/mailverifier/internal/mailverifier"
 	"github.com/hhn-mc/mailverifier/internal/player"
+	"github.com/hhn-mc/mailverifier/internal/webhook"
 )
 
 const configPathEnv = "MAILVERIFIER_CONFIG_PATH"
 
-var configPath = "config.yaml"
+const usage = `Usage: mailverifier [command] [flags]
+
+Commands:
+  serve          Start the API (default)
+  config init    Write the default config
+  config check   Validate a config file
+  config print   Print the effective config with secrets masked
+  player         Show, list, verify, unverify or delete players
+  verification   List, resend or expire verifications
+  template       Render email templates with sample data
+
+Run "mailverifier <command> -h" for the flags of a command.
+`
+
+func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		serve(args)
+	case "config":
+		configCmd(args)
+	case "player":
+		playerCmd(args)
+	case "verification":
+		verificationCmd(args)
+	case "template":
+		templateCmd(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
 
 func envString(name string, value string) string {
 	envString := os.Getenv(name)
@@ -27,40 +69,36 @@ func envString(name string, value string) string {
 	return envString
 }
 
-func init() {
-	configPath = envString(configPathEnv, configPath)
-
-	if err := mailverifier.CreateConfigIfNotExist(configPath); err != nil {
-		log.Fatalf("Failed to create default config at %s; %s", configPath, err)
-	}
+func envBool(name string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(name))
+	return b
 }
 
-func main() {
-	log.Printf("Reading config from %q", configPath)
-	cfg, err := mailverifier.LoadConfig(configPath)
-	if err != nil {
-		log.Fatalf("Failed laoding config from %s; %s", configPath, err)
-	}
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", envString(configPathEnv, "config.yaml"),
+		"path of the config file, defaults to $"+configPathEnv)
+}
 
-	db := db.DB{
+func newDB(cfg mailverifier.Config) db.DB {
+	return db.DB{
 		Host:     cfg.Database.Host,
 		Database: cfg.Database.Database,
 		Username: cfg.Database.Username,
 		Password: cfg.Database.Password,
 		Timeout:  10 * time.Second,
 	}
+}
 
-	log.Printf("Opening connection to DB on %s with usernames %q",
-		cfg.Database.Host, cfg.Database.Username)
-	if err := db.Open(); err != nil {
-		log.Fatalf("Failed connecting to the database; %s", err)
-	}
-
-	if err := db.Migrate(); err != nil {
-		log.Fatalf("Failed mirgate the database schema; %s", err)
+func loggingConfig(cfg mailverifier.Config) logging.Config {
+	return logging.Config{
+		Level:   cfg.Log.Level,
+		Format:  cfg.Log.Format,
+		Privacy: cfg.Log.Privacy,
 	}
+}
 
-	mailer := mailer.Service{
+func mailerConfig(cfg mailverifier.Config) (mailer.Config, error) {
+	mailCfg := mailer.Config{
 		Host:     cfg.Email.Host,
 		SMTPHost: cfg.Email.SMTPHost,
 		Email:    cfg.Email.Email,
@@ -68,44 +106,162 @@ func main() {
 		Identity: cfg.Email.Identity,
 		Username: cfg.Email.Username,
 		Password: cfg.Email.Password,
+
+		DefaultLocale: cfg.Email.DefaultLocale,
+		TemplateDir:   cfg.Email.TemplateDir,
+		DKIM: mailer.DKIMConfig{
+			Domain:   cfg.Email.DKIM.Domain,
+			Selector: cfg.Email.DKIM.Selector,
+			KeyFile:  cfg.Email.DKIM.KeyFile,
+			Headers:  cfg.Email.DKIM.Headers,
+		},
+
+		Security:           cfg.Email.Security,
+		AuthMechanism:      cfg.Email.AuthMechanism,
+		CAFile:             cfg.Email.CAFile,
+		InsecureSkipVerify: cfg.Email.InsecureSkipVerify,
+
+		PoolSize:        cfg.Email.PoolSize,
+		PoolMaxMessages: cfg.Email.PoolMaxMessages,
+
+		RateLimit: mailer.RateLimitConfig{
+			Global:  rateLimit(cfg.Email.RateLimit.Global),
+			Domain:  rateLimit(cfg.Email.RateLimit.Domain),
+			Address: rateLimit(cfg.Email.RateLimit.Address),
+		},
+	}
+
+	for _, d := range []struct {
+		value string
+		def   time.Duration
+		dst   *time.Duration
+	}{
+		{cfg.Email.ConnectTimeout, 10 * time.Second, &mailCfg.ConnectTimeout},
+		{cfg.Email.Timeout, 30 * time.Second, &mailCfg.Timeout},
+		{cfg.Email.PoolIdleTimeout, 30 * time.Second, &mailCfg.PoolIdleTimeout},
+		{cfg.Email.RateLimit.MaxWait, 5 * time.Second, &mailCfg.RateLimit.MaxWait},
+		{cfg.Email.RateLimit.Global.Interval, 0, &mailCfg.RateLimit.Global.Interval},
+		{cfg.Email.RateLimit.Domain.Interval, 0, &mailCfg.RateLimit.Domain.Interval},
+		{cfg.Email.RateLimit.Address.Interval, 0, &mailCfg.RateLimit.Address.Interval},
+	} {
+		*d.dst = d.def
+		if d.value == "" {
+			continue
+		}
+
+		var err error
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return mailer.Config{}, err
+		}
+	}
+	return mailCfg, nil
+}
+
+// rateLimit converts cfg without the interval, which is parsed with the
+// other durations.
+func rateLimit(cfg mailverifier.RateLimitConfig) mailer.RateLimit {
+	return mailer.RateLimit{Limit: cfg.Limit, Burst: cfg.Burst}
+}
+
+func verificationEmailConfig(cfg mailverifier.Config) (player.VerificationEmailConfig, error) {
+	emailRegex, err := regexp.Compile(cfg.EmailRegex)
+	if err != nil {
+		return player.VerificationEmailConfig{}, err
 	}
 
 	validityDuration, err := time.ParseDuration(cfg.EmailValidityDuration)
 	if err != nil {
-		log.Fatalf("Failed parse email validity duration; %s", err)
+		return player.VerificationEmailConfig{}, err
 	}
 
-	veCfg := player.VerificationEmailConfig{
-		EmailRegex:             cfg.EmailRegex,
+	notifications := player.NotificationConfig{
+		Verified: cfg.Notifications.Verified,
+		Revoked:  cfg.Notifications.Revoked,
+	}
+	if reminder := cfg.Notifications.ExpiryReminder; reminder.Enabled {
+		if notifications.ExpiryReminder, err = time.ParseDuration(reminder.Before); err != nil {
+			return player.VerificationEmailConfig{}, err
+		}
+	}
+
+	return player.VerificationEmailConfig{
+		EmailRegex:             emailRegex,
 		VerificationCodeLength: cfg.VerificationCodeLength,
 		EmailValidityDuration:  validityDuration,
 		MaxEmailTries:          cfg.MaxEmailTries,
+		Notifications:          notifications,
+		ExpireByAge:            cfg.ExpireByAge,
+	}, nil
+}
+
+// verificationValidity returns how long verifications by email are
+// valid, or 0 if they do not expire by age.
+func verificationValidity(veCfg player.VerificationEmailConfig) time.Duration {
+	if !veCfg.ExpireByAge {
+		return 0
 	}
+	return veCfg.EmailValidityDuration
+}
 
-	r := chi.NewRouter()
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Route("/players", func(r chi.Router) {
-		r.Get("/{uuid}", player.GetPlayerHandler(&db))
-		r.Post("/", player.PostPlayerHandler(&db))
-		r.Route("/{uuid}/verifications", func(r chi.Router) {
-			r.Use(player.ByUUIDMiddleware(&db))
-			r.Get("/", player.GetVerificationsHandler(&db))
-			r.Post("/", player.PostVerificationHandler(&db))
-			r.Post("/verify", player.PostVerificationVerifyHandler(&db))
-		})
-		r.Route("/{uuid}/verification-emails", func(r chi.Router) {
-			r.Use(player.ByUUIDMiddleware(&db))
-			r.Post("/", player.PostVerificationEmailHandler(veCfg, mailer, &db))
+func webhookConfig(cfg mailverifier.Config) (webhook.Config, error) {
+	wCfg := webhook.Config{MaxAttempts: 8}
+	if cfg.Webhooks.MaxAttempts > 0 {
+		wCfg.MaxAttempts = cfg.Webhooks.MaxAttempts
+	}
+
+	for _, d := range []struct {
+		value string
+		def   time.Duration
+		dst   *time.Duration
+	}{
+		{cfg.Webhooks.Timeout, 10 * time.Second, &wCfg.Timeout},
+		{cfg.Webhooks.InitialBackoff, 30 * time.Second, &wCfg.InitialBackoff},
+		{cfg.Webhooks.MaxBackoff, time.Hour, &wCfg.MaxBackoff},
+	} {
+		*d.dst = d.def
+		if d.value == "" {
+			continue
+		}
+
+		var err error
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return webhook.Config{}, err
+		}
+	}
+
+	for _, sub := range cfg.Webhooks.Subscriptions {
+		wCfg.Subscriptions = append(wCfg.Subscriptions, webhook.Subscription{
+			Name:   sub.Name,
+			URL:    sub.URL,
+			Secret: sub.Secret,
+			Events: sub.Events,
 		})
-	})
+	}
+	return wCfg, nil
+}
+
+// eventBus returns the event bus for the configured backend.
+func eventBus(cfg mailverifier.Config, db *db.DB) *events.Bus {
+	if cfg.Events.Backend == "postgres" {
+		return events.NewBus(db.EventTransport())
+	}
+	return events.NewBus(nil)
+}
+
+// apiAuth holds the API keys in a form that can be swapped on reload.
+type apiAuth struct {
+	keys     []auth.Key
+	required bool
+}
 
-	srv := http.Server{
-		Addr:    cfg.API.Bind,
-		Handler: r,
+func authConfig(cfg mailverifier.Config) (apiAuth, error) {
+	keys := make([]auth.Key, 0, len(cfg.Auth.Keys))
+	for _, k := range cfg.Auth.Keys {
+		secret, err := k.Secret()
+		if err != nil {
+			return apiAuth{}, fmt.Errorf("API key %s; %w", k.Name, err)
+		}
+		keys = append(keys, auth.Key{Name: k.Name, Key: secret, Scopes: k.Scopes})
 	}
-	log.Printf("Starting API on %s", cfg.API.Bind)
-	log.Println(srv.ListenAndServe())
+	return apiAuth{keys: keys, required: cfg.Auth.Required}, nil
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hhn-mc/mailverifier/internal/player"
+)
+
+const playerUsage = `Usage: mailverifier player <command> [flags]
+
+Commands:
+  show <uuid>       Show a player and its verifications
+  list              List players
+  verify <uuid>     Verify a player with a code sent by email or manually
+  unverify <uuid>   Reset the verification of a player
+  delete <uuid>     Delete a player and all of its verifications
+`
+
+func playerCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, playerUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "show":
+		playerShow(args[1:])
+	case "list":
+		playerList(args[1:])
+	case "verify":
+		playerVerify(args[1:])
+	case "unverify":
+		playerUnverify(args[1:])
+	case "delete":
+		playerDelete(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown player command %q\n\n%s", args[0], playerUsage)
+		os.Exit(2)
+	}
+}
+
+func playerShow(args []string) {
+	fs := flag.NewFlagSet("player show", flag.ExitOnError)
+	configPath := configFlag(fs)
+	output := outputFlag(fs)
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	ctx := env.context()
+	p, err := env.svc.Player(ctx, uuid)
+	if err != nil {
+		fatalf("Failed getting player %s; %s", uuid, err)
+	}
+
+	verifications, err := env.svc.Verifications(ctx, uuid)
+	if err != nil {
+		fatalf("Failed getting verifications of %s; %s", uuid, err)
+	}
+
+	out := struct {
+		player.Player
+		Verifications []player.Verification `json:"verifications"`
+	}{p, verifications}
+	printOutput(*output, out, func(w io.Writer) {
+		fmt.Fprintf(w, "UUID:\t%s\n", p.UUID)
+		fmt.Fprintf(w, "Username:\t%s\n", p.Username)
+		fmt.Fprintf(w, "Verified:\t%t\n", p.IsVerified)
+		fmt.Fprintf(w, "Created:\t%s\n", formatTime(&p.CreatedAt))
+		fmt.Fprintf(w, "Verifications:\t%d\n", len(verifications))
+	})
+}
+
+func playerList(args []string) {
+	fs := flag.NewFlagSet("player list", flag.ExitOnError)
+	configPath := configFlag(fs)
+	output := outputFlag(fs)
+	status := fs.String("status", "all", "all, verified or unverified")
+	limit := fs.Int("limit", 50, "maximum number of players")
+	offset := fs.Int("offset", 0, "number of players to skip")
+	fs.Parse(args)
+
+	filter := player.PlayerFilter{Limit: *limit, Offset: *offset}
+	switch *status {
+	case "all":
+	case "verified", "unverified":
+		verified := *status == "verified"
+		filter.Verified = &verified
+	default:
+		fatalf("Unknown status %q", *status)
+	}
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	players, err := env.svc.Players(env.context(), filter)
+	if err != nil {
+		fatalf("Failed listing players; %s", err)
+	}
+
+	printOutput(*output, players, func(w io.Writer) {
+		fmt.Fprintln(w, "UUID\tUSERNAME\tVERIFIED\tCREATED")
+		for _, p := range players {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", p.UUID, p.Username, p.IsVerified, formatTime(&p.CreatedAt))
+		}
+	})
+}
+
+func playerVerify(args []string) {
+	fs := flag.NewFlagSet("player verify", flag.ExitOnError)
+	configPath := configFlag(fs)
+	code := fs.String("code", "", "verification code sent to the player")
+	manual := fs.Bool("manual", false, "verify without a code, requires -reason")
+	reason := fs.String("reason", "", "reason for a manual verification")
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	var v player.Verification
+	var err error
+	if *manual {
+		v, err = env.svc.VerifyManually(env.context(), uuid, player.AdminAction{Reason: *reason})
+	} else {
+		v, err = env.svc.Verify(env.context(), uuid, *code)
+	}
+	if err != nil {
+		fatalf("Failed verifying player %s; %s", uuid, err)
+	}
+	fmt.Printf("Verified player %s with verification %d\n", uuid, v.ID)
+}
+
+func playerUnverify(args []string) {
+	fs := flag.NewFlagSet("player unverify", flag.ExitOnError)
+	configPath := configFlag(fs)
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	v, err := env.svc.Unverify(env.context(), uuid)
+	if err != nil {
+		fatalf("Failed unverifying player %s; %s", uuid, err)
+	}
+	fmt.Printf("Reset verification %d of player %s\n", v.ID, uuid)
+}
+
+func playerDelete(args []string) {
+	fs := flag.NewFlagSet("player delete", flag.ExitOnError)
+	configPath := configFlag(fs)
+	yes := fs.Bool("yes", false, "confirm the deletion")
+	uuid := parseWithUUID(fs, args)
+
+	if !*yes {
+		fatalf("Refusing to delete player %s without -yes", uuid)
+	}
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	err := env.svc.DeletePlayer(env.context(), uuid)
+	if errors.Is(err, player.ErrPlayerNotFound) {
+		fatalf("Player %s does not exist", uuid)
+	}
+	if err != nil {
+		fatalf("Failed deleting player %s; %s", uuid, err)
+	}
+	fmt.Printf("Deleted player %s\n", uuid)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	pb "github.com/hhn-mc/mailverifier/api/mailverifier/v1"
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/bounce"
+	"github.com/hhn-mc/mailverifier/internal/grpcapi"
+	"github.com/hhn-mc/mailverifier/internal/httpapi"
+	"github.com/hhn-mc/mailverifier/internal/listener"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/mailverifier"
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"github.com/hhn-mc/mailverifier/internal/player"
+	"github.com/hhn-mc/mailverifier/internal/tracing"
+	"github.com/hhn-mc/mailverifier/internal/webhook"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const createConfigEnv = "MAILVERIFIER_CREATE_CONFIG"
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := configFlag(fs)
+	createConfig := fs.Bool("create-config", envBool(createConfigEnv),
+		"write the default config if the config file does not exist")
+	fs.Parse(args)
+
+	if *createConfig {
+		if err := mailverifier.CreateConfigIfNotExist(*configPath); err != nil {
+			log.Fatal().Err(err).Str("path", *configPath).Msg("Failed to create default config")
+		}
+	}
+
+	log.Info().Str("path", *configPath).Msg("Reading config")
+	cfg, err := mailverifier.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", *configPath).Msg("Failed loading config")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal().Err(err).Str("path", *configPath).Msg("Invalid config")
+	}
+
+	if err := logging.Setup(loggingConfig(cfg)); err != nil {
+		log.Fatal().Err(err).Msg("Failed setting up logging")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.Ratio(),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setting up tracing")
+	}
+
+	db := newDB(cfg)
+	if cfg.Tracing.Enabled {
+		db.QueryTracer = tracing.PgxTracer{}
+	}
+
+	log.Info().
+		Str("host", cfg.Database.Host).
+		Str("username", cfg.Database.Username).
+		Msg("Opening connection to DB")
+	if err := db.Open(); err != nil {
+		log.Fatal().Err(err).Msg("Failed connecting to the database")
+	}
+
+	if err := db.Migrate(); err != nil {
+		log.Fatal().Err(err).Msg("Failed migrating the database schema")
+	}
+
+	if err := metrics.RegisterDBPool(db.Pool); err != nil {
+		log.Fatal().Err(err).Msg("Failed registering database pool metrics")
+	}
+
+	mailCfg, err := mailerConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing email config")
+	}
+	mail, err := mailer.NewService(mailCfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setting up the mailer")
+	}
+
+	apiTimeouts, err := parseAPITimeouts(cfg.API)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing API timeouts")
+	}
+
+	var veCfg atomic.Value
+	initialVECfg, err := verificationEmailConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing verification email config")
+	}
+	veCfg.Store(initialVECfg)
+	db.VerificationValidity = func() time.Duration {
+		return verificationValidity(veCfg.Load().(player.VerificationEmailConfig))
+	}
+
+	var authCfg atomic.Value
+	initialAuthCfg, err := authConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed reading API keys")
+	}
+	authCfg.Store(initialAuthCfg)
+
+	initialWebhookCfg, err := webhookConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing webhook config")
+	}
+	webhooks := webhook.NewDispatcher(&db, initialWebhookCfg)
+
+	bus := eventBus(cfg, &db)
+	var streamDuration time.Duration
+	if cfg.Events.MaxStreamDuration != "" {
+		if streamDuration, err = time.ParseDuration(cfg.Events.MaxStreamDuration); err != nil {
+			log.Fatal().Err(err).Msg("Failed parsing max stream duration")
+		}
+	}
+
+	reloader := mailverifier.NewReloader(*configPath, cfg)
+	// Every section is applied on its own, so a failing one does not
+	// keep the others from taking effect.
+	reloader.OnReload(func(cfg mailverifier.Config) error {
+		if err := logging.Setup(loggingConfig(cfg)); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+		return nil
+	})
+	reloader.OnReload(func(cfg mailverifier.Config) error {
+		mailCfg, err := mailerConfig(cfg)
+		if err == nil {
+			err = mail.Reload(mailCfg)
+		}
+		if err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		return nil
+	})
+	reloader.OnReload(func(cfg mailverifier.Config) error {
+		webhookCfg, err := webhookConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("webhooks: %w", err)
+		}
+		webhooks.Reload(webhookCfg)
+		return nil
+	})
+	reloader.OnReload(func(cfg mailverifier.Config) error {
+		newVECfg, err := verificationEmailConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("verification email: %w", err)
+		}
+		veCfg.Store(newVECfg)
+		return nil
+	})
+	reloader.OnReload(func(cfg mailverifier.Config) error {
+		newAuthCfg, err := authConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		authCfg.Store(newAuthCfg)
+		return nil
+	})
+
+	var watchInterval time.Duration
+	if cfg.Reload.WatchInterval != "" {
+		watchInterval, err = time.ParseDuration(cfg.Reload.WatchInterval)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed parsing config watch interval")
+		}
+	}
+
+	auditLog := &audit.Log{Repo: &db}
+	svc := &player.Service{
+		Repo:     &db,
+		Mailer:   mail,
+		Audit:    auditLog,
+		Webhooks: webhooks,
+		Events:   bus,
+		Config: func() player.VerificationEmailConfig {
+			return veCfg.Load().(player.VerificationEmailConfig)
+		},
+	}
+	bounces := &bounce.Processor{Recorder: svc}
+
+	metricsPath := ""
+	if cfg.Metrics.Enabled {
+		metricsPath = cfg.Metrics.Path
+	}
+	r := httpapi.NewRouter(httpapi.Config{
+		Players:  svc,
+		Repo:     &db,
+		Audit:    &db,
+		Webhooks: webhooks,
+		Events:   bus,
+		Mail:     mail,
+		Bounces:  bounces,
+		Keys: func() []auth.Key {
+			return authCfg.Load().(apiAuth).keys
+		},
+		AuthRequired: func() bool {
+			return authCfg.Load().(apiAuth).required
+		},
+		MetricsPath:    metricsPath,
+		MaxBodyBytes:   cfg.API.MaxBodyBytes,
+		StreamDuration: streamDuration,
+	})
+
+	srv := http.Server{
+		Addr:              cfg.API.Bind,
+		Handler:           r,
+		ReadTimeout:       apiTimeouts.read,
+		ReadHeaderTimeout: apiTimeouts.readHeader,
+		WriteTimeout:      apiTimeouts.write,
+		IdleTimeout:       apiTimeouts.idle,
+		MaxHeaderBytes:    cfg.API.MaxHeaderBytes,
+	}
+	// Shutdown waits for all requests, so event streams are ended.
+	srv.RegisterOnShutdown(bus.Close)
+
+	if cfg.API.TLS.Enabled {
+		host, _, _ := net.SplitHostPort(cfg.API.Bind)
+		srv.TLSConfig, err = listener.NewTLSConfig(listener.TLSConfig{
+			CertFile:     cfg.API.TLS.CertFile,
+			KeyFile:      cfg.API.TLS.KeyFile,
+			SelfSigned:   cfg.API.TLS.SelfSigned,
+			ClientCAFile: cfg.API.TLS.ClientCAFile,
+			ClientAuth:   cfg.API.TLS.ClientAuth,
+		}, host)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed setting up TLS")
+		}
+	}
+
+	ln, err := listener.Listen(cfg.API.Bind)
+	if err != nil {
+		log.Fatal().Err(err).Str("bind", cfg.API.Bind).Msg("Failed binding API")
+	}
+
+	var grpcSrv *grpc.Server
+	var grpcLn net.Listener
+	if cfg.GRPC.Enabled {
+		opts := []grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(
+				grpcapi.RequestInterceptor,
+				grpcapi.AuthInterceptor(
+					func() []auth.Key { return authCfg.Load().(apiAuth).keys },
+					func() bool { return authCfg.Load().(apiAuth).required },
+				),
+			),
+		}
+		if srv.TLSConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(srv.TLSConfig)))
+		}
+		grpcSrv = grpc.NewServer(opts...)
+		pb.RegisterMailVerifierServiceServer(grpcSrv, &grpcapi.Server{Svc: svc})
+
+		grpcLn, err = listener.Listen(cfg.GRPC.Bind)
+		if err != nil {
+			log.Fatal().Err(err).Str("bind", cfg.GRPC.Bind).Msg("Failed binding gRPC API")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// workers tracks background goroutines that have to finish
+	// before the database pool can be closed.
+	var workers sync.WaitGroup
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		reloader.Watch(ctx, watchInterval)
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhooks.Run(ctx)
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		bus.Run(ctx)
+	}()
+
+	if cfg.Bounces.Maildir != "" {
+		maildir := &bounce.Maildir{
+			Path:      cfg.Bounces.Maildir,
+			Interval:  time.Minute,
+			Processor: bounces,
+		}
+		if cfg.Bounces.PollInterval != "" {
+			if maildir.Interval, err = time.ParseDuration(cfg.Bounces.PollInterval); err != nil {
+				log.Fatal().Err(err).Msg("Failed parsing bounce poll interval")
+			}
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			maildir.Run(ctx)
+		}()
+	}
+
+	expiryInterval := 10 * time.Minute
+	if cfg.ExpiryCheckInterval != "" {
+		if expiryInterval, err = time.ParseDuration(cfg.ExpiryCheckInterval); err != nil {
+			log.Fatal().Err(err).Msg("Failed parsing expiry check interval")
+		}
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		svc.RunExpiry(ctx, expiryInterval)
+	}()
+
+	reminderInterval := time.Hour
+	if cfg.Notifications.ExpiryReminder.CheckInterval != "" {
+		if reminderInterval, err = time.ParseDuration(cfg.Notifications.ExpiryReminder.CheckInterval); err != nil {
+			log.Fatal().Err(err).Msg("Failed parsing expiry reminder check interval")
+		}
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		svc.RunExpiryReminders(ctx, reminderInterval)
+	}()
+
+	var auditRetention time.Duration
+	if cfg.Audit.Retention != "" {
+		if auditRetention, err = time.ParseDuration(cfg.Audit.Retention); err != nil {
+			log.Fatal().Err(err).Msg("Failed parsing audit retention")
+		}
+	}
+
+	if auditRetention > 0 {
+		purgeInterval := 24 * time.Hour
+		if cfg.Audit.PurgeInterval != "" {
+			if purgeInterval, err = time.ParseDuration(cfg.Audit.PurgeInterval); err != nil {
+				log.Fatal().Err(err).Msg("Failed parsing audit purge interval")
+			}
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			auditLog.RunPurge(ctx, purgeInterval, auditRetention)
+		}()
+	}
+
+	srvErr := make(chan error, 2)
+	go func() {
+		log.Info().
+			Str("bind", cfg.API.Bind).
+			Bool("tls", cfg.API.TLS.Enabled).
+			Msg("Starting API")
+		if cfg.API.TLS.Enabled {
+			srvErr <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		srvErr <- srv.Serve(ln)
+	}()
+
+	if grpcSrv != nil {
+		go func() {
+			log.Info().
+				Str("bind", cfg.GRPC.Bind).
+				Bool("tls", cfg.API.TLS.Enabled).
+				Msg("Starting gRPC API")
+			if err := grpcSrv.Serve(grpcLn); err != nil {
+				srvErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-srvErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("API stopped unexpectedly")
+		}
+	case <-ctx.Done():
+		log.Info().Msg("Received shutdown signal")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), apiTimeouts.shutdown)
+	defer cancel()
+
+	log.Info().Dur("timeout", apiTimeouts.shutdown).Msg("Shutting down API")
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed shutting down API gracefully")
+	}
+
+	if grpcSrv != nil {
+		log.Info().Msg("Shutting down gRPC API")
+		grpcDone := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(grpcDone)
+		}()
+		select {
+		case <-grpcDone:
+		case <-shutdownCtx.Done():
+			log.Error().Msg("Failed shutting down gRPC API gracefully")
+			grpcSrv.Stop()
+		}
+	}
+
+	log.Info().Msg("Waiting for background workers")
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		svc.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		log.Warn().Msg("Background workers did not finish in time")
+	}
+
+	log.Info().Msg("Closing SMTP connections")
+	mail.Close()
+
+	log.Info().Msg("Closing database connections")
+	db.Close()
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed flushing traces")
+	}
+	log.Info().Msg("Shutdown complete")
+}
+
+type apiTimeouts struct {
+	read       time.Duration
+	readHeader time.Duration
+	write      time.Duration
+	idle       time.Duration
+	shutdown   time.Duration
+}
+
+func parseAPITimeouts(cfg mailverifier.APIConfig) (apiTimeouts, error) {
+	var t apiTimeouts
+	for _, d := range []struct {
+		value string
+		def   time.Duration
+		dst   *time.Duration
+	}{
+		{cfg.ReadTimeout, 15 * time.Second, &t.read},
+		{cfg.ReadHeaderTimeout, 5 * time.Second, &t.readHeader},
+		{cfg.WriteTimeout, 30 * time.Second, &t.write},
+		{cfg.IdleTimeout, 2 * time.Minute, &t.idle},
+		{cfg.ShutdownTimeout, 30 * time.Second, &t.shutdown},
+	} {
+		*d.dst = d.def
+		if d.value == "" {
+			continue
+		}
+
+		var err error
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return apiTimeouts{}, err
+		}
+	}
+	return t, nil
+}
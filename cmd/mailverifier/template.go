@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/mailverifier"
+)
+
+const templateUsage = `Usage: mailverifier template <command> [flags]
+
+Commands:
+  render <name>   Render an email template with sample data
+`
+
+func templateCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, templateUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "render":
+		templateRender(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown template command %q\n\n%s", args[0], templateUsage)
+		os.Exit(2)
+	}
+}
+
+func templateRender(args []string) {
+	fs := flag.NewFlagSet("template render", flag.ExitOnError)
+	configPath := configFlag(fs)
+	locale := fs.String("locale", "", "locale to render, defaults to email.default_locale")
+	dir := fs.String("dir", "", "template directory to use instead of email.template_dir")
+	format := fs.String("format", "html", "part to write: html, text, subject or json for all")
+	out := fs.String("o", "", "file to write to instead of stdout")
+
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		fatalf("Missing template name, one of %s", strings.Join(mailer.TemplateNames(), ", "))
+	}
+
+	cfg, err := mailverifier.LoadConfig(*configPath)
+	if err != nil {
+		fatalf("Failed loading config from %s; %s", *configPath, err)
+	}
+
+	mailCfg, err := mailerConfig(cfg)
+	if err != nil {
+		fatalf("Failed parsing email config; %s", err)
+	}
+	if *dir != "" {
+		mailCfg.TemplateDir = *dir
+	}
+	mail, err := mailer.NewService(mailCfg)
+	if err != nil {
+		fatalf("Failed loading email templates; %s", err)
+	}
+
+	rendered, err := mail.Preview(name, *locale)
+	if err != nil {
+		fatalf("Failed rendering template %s; %s", name, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatalf("Failed creating %s; %s", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "html":
+		_, err = io.WriteString(w, rendered.HTML)
+	case "text":
+		_, err = io.WriteString(w, rendered.Text)
+	case "subject":
+		_, err = fmt.Fprintln(w, rendered.Subject)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rendered)
+	default:
+		fatalf("Unknown format %q, must be html, text, subject or json", *format)
+	}
+	if err != nil {
+		fatalf("Failed writing template; %s", err)
+	}
+
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %s template %s (%s) to %s\n", *format, name, rendered.Locale, *out)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hhn-mc/mailverifier/internal/player"
+)
+
+const verificationUsage = `Usage: mailverifier verification <command> [flags]
+
+Commands:
+  list <uuid>     List the verifications of a player
+  resend <uuid>   Send a new code, by default to the last used address
+  expire <uuid>   Expire the latest verification of a player
+  revoke <uuid>   Revoke a verification of a player
+`
+
+func verificationCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, verificationUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		verificationList(args[1:])
+	case "resend":
+		verificationResend(args[1:])
+	case "expire":
+		verificationExpire(args[1:])
+	case "revoke":
+		verificationRevoke(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown verification command %q\n\n%s", args[0], verificationUsage)
+		os.Exit(2)
+	}
+}
+
+func verificationList(args []string) {
+	fs := flag.NewFlagSet("verification list", flag.ExitOnError)
+	configPath := configFlag(fs)
+	output := outputFlag(fs)
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	verifications, err := env.svc.Verifications(env.context(), uuid)
+	if err != nil {
+		fatalf("Failed getting verifications of %s; %s", uuid, err)
+	}
+
+	printOutput(*output, verifications, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tEMAIL\tVERIFIED\tEXPIRES\tSENT\tBOUNCED\tCOMPLAINED")
+		for _, v := range verifications {
+			if len(v.Emails) == 0 {
+				fmt.Fprintf(w, "%d\t-\t-\t%s\t-\t-\t-\n", v.ID, formatTime(v.ExpiredAt))
+			}
+			for _, e := range v.Emails {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					v.ID, e.Email, formatTime(e.VerifiedAt), formatTime(e.ExpiresAt), formatTime(&e.CreatedAt),
+					formatTime(e.BouncedAt), formatTime(e.ComplainedAt))
+			}
+		}
+	})
+}
+
+func verificationResend(args []string) {
+	fs := flag.NewFlagSet("verification resend", flag.ExitOnError)
+	configPath := configFlag(fs)
+	email := fs.String("email", "", "send to this address instead of the last used one")
+	locale := fs.String("locale", "", "locale of the email sent to -email, e.g. de or en")
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	ctx := env.context()
+	p, err := env.svc.Player(ctx, uuid)
+	if err != nil {
+		fatalf("Failed getting player %s; %s", uuid, err)
+	}
+
+	var ve player.VerificationEmail
+	if *email != "" {
+		ve, err = env.svc.SendVerificationEmail(ctx, p, *email, *locale)
+	} else {
+		ve, err = env.svc.ResendVerificationEmail(ctx, p)
+	}
+	if err != nil {
+		fatalf("Failed sending verification email to player %s; %s", uuid, err)
+	}
+	fmt.Printf("Sent verification email to %s\n", ve.Email)
+}
+
+func verificationExpire(args []string) {
+	fs := flag.NewFlagSet("verification expire", flag.ExitOnError)
+	configPath := configFlag(fs)
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	v, err := env.svc.ExpireVerification(env.context(), uuid)
+	if err != nil {
+		fatalf("Failed expiring verification of player %s; %s", uuid, err)
+	}
+	fmt.Printf("Expired verification %d of player %s\n", v.ID, uuid)
+}
+
+func verificationRevoke(args []string) {
+	fs := flag.NewFlagSet("verification revoke", flag.ExitOnError)
+	configPath := configFlag(fs)
+	id := fs.Uint64("id", 0, "ID of the verification, defaults to the latest one")
+	reason := fs.String("reason", "", "reason for the revocation")
+	uuid := parseWithUUID(fs, args)
+
+	env := openAdminEnv(*configPath)
+	defer env.Close()
+
+	ctx := env.context()
+	if *id == 0 {
+		verifications, err := env.svc.Verifications(ctx, uuid)
+		if err != nil {
+			fatalf("Failed getting verifications of %s; %s", uuid, err)
+		}
+		if len(verifications) == 0 {
+			fatalf("Player %s has no verifications", uuid)
+		}
+		*id = verifications[len(verifications)-1].ID
+	}
+
+	v, err := env.svc.Revoke(ctx, uuid, *id, player.AdminAction{Reason: *reason})
+	if err != nil {
+		fatalf("Failed revoking verification %d of player %s; %s", *id, uuid, err)
+	}
+	fmt.Printf("Revoked verification %d of player %s\n", v.ID, uuid)
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+const (
+	ActionPlayerCreated       = "player.created"
+	ActionPlayerDeleted       = "player.deleted"
+	ActionVerificationCreated = "verification.created"
+	ActionEmailSent           = "verification.email_sent"
+	ActionEmailBounced        = "verification.email_bounced"
+	ActionEmailComplained     = "verification.email_complained"
+	ActionCodeAttempt         = "verification.code_attempt"
+	ActionManualVerification  = "verification.manual"
+	ActionVerificationRevoked = "verification.revoked"
+	ActionVerificationReset   = "verification.reset"
+	ActionVerificationExpired = "verification.expired"
+	ActionExpiryReminderSent  = "verification.expiry_reminder_sent"
+	ActionAuditPurged         = "audit.purged"
+)
+
+// Event is a state-changing action. Actor, RequestID and IP are
+// taken from the context when the event is recorded.
+type Event struct {
+	ID             uint64                 `json:"id"`
+	Action         string                 `json:"action"`
+	PlayerUUID     string                 `json:"playerUuid,omitempty"`
+	VerificationID uint64                 `json:"verificationId,omitempty"`
+	Actor          string                 `json:"actor"`
+	RequestID      string                 `json:"requestId,omitempty"`
+	IP             string                 `json:"ip,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+	CreatedAt      time.Time              `json:"createdAt"`
+}
+
+type Filter struct {
+	PlayerUUID string
+	Action     string
+	Actor      string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	Offset     int
+}
+
+type Repo interface {
+	CreateAuditEvent(ctx context.Context, e *Event) error
+	AuditEvents(ctx context.Context, filter Filter) ([]Event, error)
+	// DeleteAuditEvents deletes the events older than retention and
+	// returns their number.
+	DeleteAuditEvents(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// Log records audit events. A nil Log discards all events.
+type Log struct {
+	Repo Repo
+}
+
+// Record stores e. Failures are logged instead of returned, as the
+// action has already taken place when it is recorded.
+func (l *Log) Record(ctx context.Context, e Event) {
+	if l == nil {
+		return
+	}
+
+	e.Actor = auth.Actor(ctx)
+	e.RequestID = middleware.GetReqID(ctx)
+	e.IP, _ = ctx.Value(ctxIPKey).(string)
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+
+	if err := l.Repo.CreateAuditEvent(ctx, &e); err != nil {
+		logging.Ctx(ctx).Error().Err(err).
+			Str("action", e.Action).
+			Str("player_uuid", e.PlayerUUID).
+			Msg("Failed recording audit event")
+	}
+}
+
+// RunPurge deletes events older than retention in the interval until
+// ctx is done.
+func (l *Log) RunPurge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := l.Purge(ctx, retention); err != nil && ctx.Err() == nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Failed purging audit events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeActor is the actor of the events recorded for purges.
+const PurgeActor = "system:audit-purge"
+
+// Purge deletes events older than retention and records the purge
+// itself if any were deleted. It returns the number of deleted events.
+func (l *Log) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx = auth.WithIdentity(ctx, auth.Identity{Name: PurgeActor})
+
+	deleted, err := l.Repo.DeleteAuditEvents(ctx, retention)
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		l.Record(ctx, Event{
+			Action:  ActionAuditPurged,
+			Details: map[string]interface{}{"deleted": deleted, "retention": retention.String()},
+		})
+	}
+	return deleted, nil
+}
+
+type ctxKey int
+
+const ctxIPKey ctxKey = iota
+
+// WithIP returns a copy of ctx carrying the client IP.
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxIPKey, ip)
+}
+
+// Middleware stores the client IP for the events recorded during
+// the request. It has to be used after middleware.RealIP.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIP(r.Context(), ip)))
+	})
+}
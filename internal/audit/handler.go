@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// parseFilter reads the filter from the query parameters playerUuid,
+// action, actor, since, until (RFC 3339), limit and offset.
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	filter := Filter{
+		PlayerUUID: q.Get("playerUuid"),
+		Action:     q.Get("action"),
+		Actor:      q.Get("actor"),
+		Limit:      defaultLimit,
+	}
+
+	errs := validation.Errors{
+		"playerUuid": validation.Validate(filter.PlayerUUID, is.UUIDv4),
+		"since":      validation.Validate(q.Get("since"), validation.Date(time.RFC3339)),
+		"until":      validation.Validate(q.Get("until"), validation.Date(time.RFC3339)),
+		"limit":      validation.Validate(q.Get("limit"), is.Int),
+		"offset":     validation.Validate(q.Get("offset"), is.Int),
+	}
+	if err := errs.Filter(); err != nil {
+		return Filter{}, err
+	}
+
+	if since, err := time.Parse(time.RFC3339, q.Get("since")); err == nil {
+		filter.Since = &since
+	}
+	if until, err := time.Parse(time.RFC3339, q.Get("until")); err == nil {
+		filter.Until = &until
+	}
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(q.Get("offset")); err == nil {
+		filter.Offset = offset
+	}
+
+	return filter, validation.Errors{
+		"limit":  validation.Validate(filter.Limit, validation.Min(1), validation.Max(maxLimit)),
+		"offset": validation.Validate(filter.Offset, validation.Min(0)),
+	}.Filter()
+}
+
+func GetEventsHandler(repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		events, err := repo.AuditEvents(r.Context(), filter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed getting audit events")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(events); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding audit events")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+// ScopeAdmin grants access to the administrative endpoints.
+const ScopeAdmin = "admin"
+
+// Anonymous is the actor of requests without an API key.
+const Anonymous = "anonymous"
+
+type Key struct {
+	Name   string
+	Key    string
+	Scopes []string
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	Name   string
+	Scopes []string
+}
+
+func (id Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey int
+
+const ctxIdentityKey ctxKey = iota
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxIdentityKey, id)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxIdentityKey).(Identity)
+	return id, ok
+}
+
+// Actor returns the name of the caller for audit purposes.
+func Actor(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id.Name
+	}
+	return Anonymous
+}
+
+var (
+	ErrKeyRequired = errors.New("API key required")
+	ErrInvalidKey  = errors.New("invalid API key")
+)
+
+// Authenticate returns a copy of ctx carrying the identity of the key
+// matching secret. Without a secret, ctx is returned unchanged unless
+// a key is required.
+func Authenticate(ctx context.Context, keys []Key, secret string, required bool) (context.Context, error) {
+	if secret == "" {
+		if required {
+			return ctx, ErrKeyRequired
+		}
+		return ctx, nil
+	}
+
+	key, ok := lookup(keys, secret)
+	if !ok {
+		logging.Ctx(ctx).Warn().Str("api_key", logging.Secret(secret)).Msg("Rejected invalid API key")
+		return ctx, ErrInvalidKey
+	}
+
+	ctx = WithIdentity(ctx, Identity{Name: key.Name, Scopes: key.Scopes})
+	return logging.WithFields(ctx, map[string]interface{}{
+		"actor": key.Name,
+	}), nil
+}
+
+// lookup returns the key matching secret. All keys are compared in
+// constant time to not leak which prefix matched.
+func lookup(keys []Key, secret string) (Key, bool) {
+	var found Key
+	ok := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(secret)) == 1 {
+			found, ok = k, true
+		}
+	}
+	return found, ok
+}
+
+func secretFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	const prefix = "bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) > len(prefix) && strings.ToLower(header[:len(prefix)]) == prefix {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+// Middleware authenticates requests carrying an API key in the
+// Authorization (Bearer) or X-API-Key header. Requests with an unknown
+// key are rejected. Requests without a key are only rejected if required
+// is set; otherwise they continue anonymously. keys is called for every
+// request, so reloaded keys take effect immediately.
+func Middleware(keys func() []Key, required func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := Authenticate(r.Context(), keys(), secretFromRequest(r), required())
+			switch {
+			case errors.Is(err, ErrKeyRequired):
+				http.Error(w, "API key required", http.StatusUnauthorized)
+				return
+			case errors.Is(err, ErrInvalidKey):
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests whose identity lacks scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := FromContext(r.Context())
+			if !ok {
+				http.Error(w, "API key required", http.StatusUnauthorized)
+				return
+			}
+
+			if !id.HasScope(scope) {
+				http.Error(w, "Missing scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
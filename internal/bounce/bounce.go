@@ -0,0 +1,58 @@
+package bounce
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hhn-mc/mailverifier/internal/player"
+)
+
+// Recorder marks verification emails as bounced or complained about.
+type Recorder interface {
+	RecordBounce(ctx context.Context, messageID string, recipient string, reason string) (player.BouncedEmail, error)
+	RecordComplaint(ctx context.Context, messageID string, recipient string, feedbackType string) (player.BouncedEmail, error)
+}
+
+// Result is the outcome of processing a report.
+type Result struct {
+	Report
+	// Matched is false if the report is about no verification email or
+	// the email was already reported the same way.
+	Matched        bool   `json:"matched"`
+	PlayerUUID     string `json:"playerUuid,omitempty"`
+	VerificationID uint64 `json:"verificationId,omitempty"`
+}
+
+// Processor marks the emails of DSN reports as bounced and of ARF
+// reports as complained about.
+type Processor struct {
+	Recorder Recorder
+}
+
+// Process records the reports. Reports are matched by the Message-ID of
+// the original message, or by recipient if the report lacks it.
+func (p *Processor) Process(ctx context.Context, reports []Report) ([]Result, error) {
+	results := make([]Result, len(reports))
+	for i, report := range reports {
+		results[i].Report = report
+
+		var b player.BouncedEmail
+		var err error
+		if report.Type == TypeARF {
+			b, err = p.Recorder.RecordComplaint(ctx, report.MessageID, report.Recipient, report.Status)
+		} else {
+			b, err = p.Recorder.RecordBounce(ctx, report.MessageID, report.Recipient, report.Reason())
+		}
+		if errors.Is(err, player.ErrEmailNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		results[i].Matched = true
+		results[i].PlayerUUID = b.PlayerUUID
+		results[i].VerificationID = b.VerificationID
+	}
+	return results, nil
+}
@@ -0,0 +1,52 @@
+package bounce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hhn-mc/mailverifier/internal/player"
+)
+
+// fakeRecorder records which kind of report was recorded per recipient.
+type fakeRecorder struct {
+	recorded map[string]string
+}
+
+func (r *fakeRecorder) RecordBounce(ctx context.Context, messageID string, recipient string, reason string) (player.BouncedEmail, error) {
+	r.recorded[recipient] = "bounce " + reason
+	return player.BouncedEmail{PlayerUUID: "p1"}, nil
+}
+
+func (r *fakeRecorder) RecordComplaint(ctx context.Context, messageID string, recipient string, feedbackType string) (player.BouncedEmail, error) {
+	r.recorded[recipient] = "complaint " + feedbackType
+	return player.BouncedEmail{PlayerUUID: "p1"}, nil
+}
+
+func TestProcessComplaints(t *testing.T) {
+	recorder := &fakeRecorder{recorded: map[string]string{}}
+	p := &Processor{Recorder: recorder}
+
+	results, err := p.Process(context.Background(), []Report{
+		{Type: TypeDSN, Recipient: "steve@example.com", Status: "5.1.1"},
+		{Type: TypeARF, Recipient: "alex@example.com", Status: "abuse", Diagnostic: "complaint"},
+	})
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	for _, result := range results {
+		if !result.Matched {
+			t.Errorf("report for %s not matched", result.Recipient)
+		}
+	}
+
+	// Complaints must not be refunded like bounces.
+	want := map[string]string{
+		"steve@example.com": "bounce 5.1.1",
+		"alex@example.com":  "complaint abuse",
+	}
+	for recipient, kind := range want {
+		if got := recorder.recorded[recipient]; got != kind {
+			t.Errorf("%s recorded as %q, want %q", recipient, got, kind)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package bounce
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+// PostBounceHandler processes a bounce forwarded as raw message in the
+// request body and responds with the results.
+func PostBounceHandler(p *Processor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reports, err := Parse(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := p.Process(r.Context(), reports)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed processing bounce")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding bounce results")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,104 @@
+package bounce
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Maildir processes the bounces delivered to a maildir, e.g. by the MTA
+// or fetchmail from the mailbox of the sender address. Messages are
+// read from new and moved to cur once processed.
+type Maildir struct {
+	Path      string
+	Interval  time.Duration
+	Processor *Processor
+}
+
+// Run polls the maildir until ctx is done.
+func (m *Maildir) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Poll(ctx); err != nil {
+			log.Error().Err(err).Str("path", m.Path).Msg("Failed reading bounce maildir")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll processes all new messages. Messages that could not be recorded
+// stay in new to be retried.
+func (m *Maildir) Poll(ctx context.Context) error {
+	entries, err := os.ReadDir(filepath.Join(m.Path, "new"))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		logger := log.With().Str("file", entry.Name()).Logger()
+		if err := m.process(ctx, entry.Name()); err != nil {
+			logger.Error().Err(err).Msg("Failed processing bounce, retrying later")
+			continue
+		}
+		if err := m.moveToCur(entry.Name()); err != nil {
+			logger.Error().Err(err).Msg("Failed moving processed bounce")
+		}
+	}
+	return nil
+}
+
+func (m *Maildir) process(ctx context.Context, name string) error {
+	f, err := os.Open(filepath.Join(m.Path, "new", name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	logger := log.With().Str("file", name).Logger()
+	reports, err := Parse(f)
+	if err != nil {
+		// Not retried, the message will not become parsable.
+		logger.Warn().Err(err).Msg("Skipping message in bounce maildir")
+		return nil
+	}
+
+	results, err := m.Processor.Process(ctx, reports)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		logger.Info().
+			Str("type", result.Type).
+			Str("status", result.Status).
+			Bool("matched", result.Matched).
+			Str("player_uuid", result.PlayerUUID).
+			Msg("Processed bounce")
+	}
+	return nil
+}
+
+// moveToCur marks the message as seen.
+func (m *Maildir) moveToCur(name string) error {
+	return os.Rename(
+		filepath.Join(m.Path, "new", name),
+		filepath.Join(m.Path, "cur", name+":2,S"),
+	)
+}
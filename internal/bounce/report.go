@@ -0,0 +1,156 @@
+package bounce
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Report types.
+const (
+	// TypeDSN is a delivery status notification, RFC 3464.
+	TypeDSN = "dsn"
+	// TypeARF is an abuse feedback report, RFC 5965.
+	TypeARF = "arf"
+)
+
+var ErrNoReport = errors.New("message is no delivery status notification or feedback report")
+
+// Report is a failed delivery or complaint of one recipient.
+type Report struct {
+	Type      string `json:"type"`
+	Recipient string `json:"recipient"`
+	// MessageID of the original message, if the report includes its
+	// header.
+	MessageID string `json:"messageId,omitempty"`
+	// Status is the enhanced status code like 5.1.1 of a DSN or the
+	// feedback type like abuse of an ARF report.
+	Status     string `json:"status"`
+	Diagnostic string `json:"diagnostic,omitempty"`
+}
+
+// Reason summarizes the report for humans.
+func (r Report) Reason() string {
+	if r.Diagnostic == "" {
+		return r.Status
+	}
+	return r.Status + " " + r.Diagnostic
+}
+
+// Parse reads the failed recipients and complaints of a multipart/report
+// message. Delayed, delivered or relayed recipients of a DSN are skipped.
+func Parse(r io.Reader) ([]Report, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, ErrNoReport
+	}
+
+	var (
+		reports   []Report
+		messageID string
+		isReport  bool
+	)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			isReport = true
+			rr, err := parseDeliveryStatus(part)
+			if err != nil {
+				return nil, fmt.Errorf("delivery status: %w", err)
+			}
+			reports = append(reports, rr...)
+		case "message/feedback-report":
+			isReport = true
+			report, err := parseFeedbackReport(part)
+			if err != nil {
+				return nil, fmt.Errorf("feedback report: %w", err)
+			}
+			reports = append(reports, report)
+		case "message/rfc822", "message/rfc822-headers", "text/rfc822-headers",
+			"message/global", "message/global-headers":
+			header, _ := textproto.NewReader(bufio.NewReader(part)).ReadMIMEHeader()
+			if id := strings.TrimSpace(header.Get("Message-Id")); id != "" {
+				messageID = id
+			}
+		}
+	}
+	if !isReport {
+		return nil, ErrNoReport
+	}
+
+	for i := range reports {
+		reports[i].MessageID = messageID
+	}
+	return reports, nil
+}
+
+// parseDeliveryStatus returns the failed recipients. The first group of
+// fields is about the message, every following one about a recipient.
+func parseDeliveryStatus(r io.Reader) ([]Report, error) {
+	tp := textproto.NewReader(bufio.NewReader(r))
+	if _, err := tp.ReadMIMEHeader(); err != nil {
+		return nil, err
+	}
+
+	var reports []Report
+	for {
+		fields, err := tp.ReadMIMEHeader()
+		if strings.EqualFold(fields.Get("Action"), "failed") {
+			reports = append(reports, Report{
+				Type:       TypeDSN,
+				Recipient:  address(fields.Get("Final-Recipient")),
+				Status:     fields.Get("Status"),
+				Diagnostic: fields.Get("Diagnostic-Code"),
+			})
+		}
+		if errors.Is(err, io.EOF) {
+			return reports, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseFeedbackReport(r io.Reader) (Report, error) {
+	fields, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Report{}, err
+	}
+
+	return Report{
+		Type:       TypeARF,
+		Recipient:  address(fields.Get("Original-Rcpt-To")),
+		Status:     fields.Get("Feedback-Type"),
+		Diagnostic: "complaint",
+	}, nil
+}
+
+// address strips the address type like rfc822; of a DSN field.
+func address(field string) string {
+	if i := strings.Index(field, ";"); i >= 0 {
+		field = field[i+1:]
+	}
+	return strings.Trim(strings.TrimSpace(field), "<>")
+}
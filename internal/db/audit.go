@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"golang.org/x/net/context"
+)
+
+func (db *DB) CreateAuditEvent(ctx context.Context, e *audit.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	return db.QueryRow(ctx, `
+INSERT INTO audit_events (action, player_uuid, verification_id, actor, request_id, ip, details)
+VALUES ($1, NULLIF($2, '')::UUID, NULLIF($3::BIGINT, 0), $4, $5, $6, $7)
+RETURNING id, created_at
+`, e.Action, e.PlayerUUID, int64(e.VerificationID), e.Actor, e.RequestID, e.IP, e.Details).
+		Scan(&e.ID, &e.CreatedAt)
+}
+
+func (db *DB) AuditEvents(ctx context.Context, filter audit.Filter) ([]audit.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	// LIMIT NULL returns all rows
+	var limit interface{}
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+
+	rows, err := db.Query(ctx, `
+SELECT id, action, COALESCE(player_uuid::TEXT, ''), COALESCE(verification_id, 0),
+	actor, request_id, ip, details, created_at
+FROM audit_events
+WHERE ($1 = '' OR player_uuid = NULLIF($1, '')::UUID)
+	AND ($2 = '' OR action = $2)
+	AND ($3 = '' OR actor = $3)
+	AND ($4::TIMESTAMP IS NULL OR created_at >= $4)
+	AND ($5::TIMESTAMP IS NULL OR created_at < $5)
+ORDER BY created_at DESC, id DESC
+LIMIT $6 OFFSET $7
+`, filter.PlayerUUID, filter.Action, filter.Actor, filter.Since, filter.Until, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []audit.Event
+	for rows.Next() {
+		var e audit.Event
+		var vID int64
+		err := rows.Scan(&e.ID, &e.Action, &e.PlayerUUID, &vID,
+			&e.Actor, &e.RequestID, &e.IP, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.VerificationID = uint64(vID)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (db *DB) DeleteAuditEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, `
+DELETE FROM audit_events
+WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+`, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -23,10 +23,24 @@ type DB struct {
 	Username string
 	Password string
 	Timeout  time.Duration
+	// QueryTracer is notified about every executed query if set.
+	QueryTracer pgx.Logger
+	// VerificationValidity returns how long verifications by email are
+	// valid. They never expire by age if it is nil.
+	VerificationValidity func() time.Duration
 
 	*pgxpool.Pool
 }
 
+// validity returns the validity of verifications by email in seconds,
+// or 0 if they do not expire by age.
+func (db *DB) validity() float64 {
+	if db.VerificationValidity == nil {
+		return 0
+	}
+	return db.VerificationValidity().Seconds()
+}
+
 func (db DB) dsn() string {
 	addr, port, _ := net.SplitHostPort(db.Host)
 	return fmt.Sprintf(
@@ -45,6 +59,11 @@ func (db *DB) Open() error {
 		return err
 	}
 
+	if db.QueryTracer != nil {
+		cfg.ConnConfig.Logger = db.QueryTracer
+		cfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
 	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
 		conn.ConnInfo().RegisterDataType(pgtype.DataType{
 			Value: &pgtypeuuid.UUID{},
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/net/context"
+)
+
+// eventsChannel is the Postgres notification channel of events.
+const eventsChannel = "mailverifier_events"
+
+// eventTransport distributes events between replicas with LISTEN/NOTIFY.
+type eventTransport struct {
+	db *DB
+}
+
+// EventTransport returns a transport for the event bus using Postgres
+// notifications, so all replicas sharing the database receive events.
+func (db *DB) EventTransport() events.Transport {
+	return eventTransport{db: db}
+}
+
+func (t eventTransport) Notify(ctx context.Context, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, t.db.Timeout)
+	defer cancel()
+
+	_, err := t.db.Exec(ctx, `SELECT pg_notify($1, $2)`, eventsChannel, string(payload))
+	return err
+}
+
+func (t eventTransport) Listen(ctx context.Context, fn func(payload []byte)) error {
+	connectCtx, cancel := context.WithTimeout(ctx, t.db.Timeout)
+	defer cancel()
+
+	// The listener uses its own connection instead of one of the pool,
+	// as it is blocked waiting for notifications for its whole lifetime.
+	conn, err := pgx.ConnectConfig(connectCtx, t.db.Config().ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(connectCtx, `LISTEN `+eventsChannel); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		fn([]byte(n.Payload))
+	}
+}
@@ -1,16 +1,13 @@
 package db
 
 import (
-	"errors"
-	"time"
-
 	"github.com/hhn-mc/mailverifier/internal/player"
 	"github.com/jackc/pgx/v4"
 	"golang.org/x/net/context"
 )
 
-func (db *DB) PlayerWithUUIDExists(uuid string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) PlayerWithUUIDExists(ctx context.Context, uuid string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	res, err := db.Exec(ctx, `
@@ -22,46 +19,82 @@ WHERE uuid = $1;
 	return res.RowsAffected() > 0, err
 }
 
-func (db *DB) PlayerByUUID(uuid string) (player.Player, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+// playerSelect selects players and whether their latest verification
+// was verified manually or by email and has neither been expired
+// nor revoked. Verifications by email expire once they are older than
+// the validity in seconds passed as $1, unless it is 0.
+const playerSelect = `
+SELECT p.uuid, p.username, p.created_at, COALESCE(lv.verified, false) AS verified
+FROM players p
+LEFT JOIN LATERAL (
+	SELECT v.expired_at IS NULL AND v.revoked_at IS NULL AND (
+		$1::FLOAT8 = 0 OR v.method <> '` + player.MethodEmail + `' OR
+		v.created_at + make_interval(secs => $1::FLOAT8) > CURRENT_TIMESTAMP
+	) AND (
+		v.verified_at IS NOT NULL OR EXISTS (
+			SELECT 1
+			FROM verification_emails e
+			WHERE e.verification_id = v.id
+			AND e.verified_at IS NOT NULL
+		)
+	) AS verified
+	FROM verifications v
+	WHERE v.player_uuid = p.uuid
+	ORDER BY v.created_at DESC
+	LIMIT 1
+) lv ON true
+`
+
+func scanPlayer(row pgx.Row) (player.Player, error) {
+	var p player.Player
+	err := row.Scan(&p.UUID, &p.Username, &p.CreatedAt, &p.IsVerified)
+	return p, err
+}
+
+func (db *DB) PlayerByUUID(ctx context.Context, uuid string) (player.Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
-	row := db.QueryRow(ctx, `
-SELECT uuid, username, created_at
-FROM players
-WHERE uuid = $1
-`, uuid)
+	return scanPlayer(db.QueryRow(ctx, playerSelect+`
+WHERE p.uuid = $2
+`, db.validity(), uuid))
+}
 
-	var p player.Player
-	if err := row.Scan(&p.UUID, &p.Username, &p.CreatedAt); err != nil {
-		return player.Player{}, err
+func (db *DB) Players(ctx context.Context, filter player.PlayerFilter) ([]player.Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	// LIMIT NULL returns all rows
+	var limit interface{}
+	if filter.Limit > 0 {
+		limit = filter.Limit
 	}
 
-	row = db.QueryRow(ctx, `
-SELECT created_at
-FROM verification_emails
-WHERE verification_id = (
-	SELECT id
-	FROM verifications
-	WHERE player_uuid = $1
-	ORDER BY created_at DESC
-	LIMIT 1
-) AND verified_at IS NOT NULL
-`, uuid)
+	rows, err := db.Query(ctx, `
+SELECT *
+FROM (`+playerSelect+`) players
+WHERE $2::BOOLEAN IS NULL OR verified = $2
+ORDER BY created_at DESC
+LIMIT $3 OFFSET $4
+`, db.validity(), filter.Verified, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	p.IsVerified = true
-	if err := row.Scan(&time.Time{}); err != nil {
-		if !errors.Is(err, pgx.ErrNoRows) {
-			return player.Player{}, err
+	var pp []player.Player
+	for rows.Next() {
+		p, err := scanPlayer(rows)
+		if err != nil {
+			return nil, err
 		}
-		p.IsVerified = false
+		pp = append(pp, p)
 	}
-
-	return p, nil
+	return pp, rows.Err()
 }
 
-func (db *DB) CreatePlayer(p *player.Player) error {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) CreatePlayer(ctx context.Context, p *player.Player) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	return db.QueryRow(ctx, `
@@ -72,3 +105,42 @@ RETURNING created_at;
 `, p.UUID, p.Username).
 		Scan(&p.CreatedAt)
 }
+
+// DeletePlayer deletes the player including all verifications.
+func (db *DB) DeletePlayer(ctx context.Context, uuid string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+DELETE FROM verification_emails
+WHERE verification_id IN (
+	SELECT id
+	FROM verifications
+	WHERE player_uuid = $1
+);
+`, uuid); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+DELETE FROM verifications
+WHERE player_uuid = $1;
+`, uuid); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+DELETE FROM players
+WHERE uuid = $1;
+`, uuid); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -23,3 +23,58 @@ CREATE TABLE IF NOT EXISTS verification_emails
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (verification_id, code, email)
 );
+
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP;
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS method TEXT NOT NULL DEFAULT 'email';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS verified_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS verified_on_behalf_of TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS revoked_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS revoked_on_behalf_of TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS revoke_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE verifications ADD COLUMN IF NOT EXISTS reminded_at TIMESTAMP;
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS message_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS bounced_at TIMESTAMP;
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS bounce_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS complained_at TIMESTAMP;
+ALTER TABLE verification_emails ADD COLUMN IF NOT EXISTS complaint_type TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS verification_emails_message_id_idx ON verification_emails (message_id);
+CREATE INDEX IF NOT EXISTS verification_emails_email_idx ON verification_emails (LOWER(email), created_at);
+
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    action TEXT NOT NULL,
+    player_uuid UUID,
+    verification_id BIGINT,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_player_uuid_idx ON audit_events (player_uuid, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    subscription TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_status_code INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -9,44 +9,105 @@ import (
 	"golang.org/x/net/context"
 )
 
-func (db *DB) LatestVerification(pUUID string) (player.Verification, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+const verificationColumns = `
+id, player_uuid, method, reason, verified_at, verified_by, verified_on_behalf_of,
+revoked_at, revoked_by, revoked_on_behalf_of, revoke_reason, expired_at, created_at
+`
+
+func scanVerification(row pgx.Row) (player.Verification, error) {
+	var v player.Verification
+	err := row.Scan(&v.ID, &v.PlayerUUID, &v.Method, &v.Reason, &v.VerifiedAt, &v.VerifiedBy, &v.VerifiedOnBehalfOf,
+		&v.RevokedAt, &v.RevokedBy, &v.RevokedOnBehalfOf, &v.RevokeReason, &v.ExpiredAt, &v.CreatedAt)
+	return v, err
+}
+
+// withEmails loads the emails of v and derives whether it is verified.
+func (db *DB) withEmails(ctx context.Context, v player.Verification) (player.Verification, error) {
+	emails, err := db.VerificationEmails(ctx, v.ID)
+	if err != nil {
+		return player.Verification{}, err
+	}
+	v.Emails = emails
+
+	v.IsVerified = v.VerifiedAt != nil
+	for _, email := range emails {
+		if email.VerifiedAt != nil {
+			v.IsVerified = true
+			break
+		}
+	}
+	if v.RevokedAt != nil || v.ExpiredAt != nil || db.aged(v) {
+		v.IsVerified = false
+	}
+
+	return v, nil
+}
+
+// aged reports whether v is a verification by email older than the
+// validity, which has expired even if the expiry was not recorded yet.
+func (db *DB) aged(v player.Verification) bool {
+	validity := db.validity()
+	return validity > 0 && v.Method == player.MethodEmail &&
+		time.Since(v.CreatedAt).Seconds() >= validity
+}
+
+func (db *DB) LatestVerification(ctx context.Context, pUUID string) (player.Verification, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	row := db.QueryRow(ctx, `
-SELECT id, player_uuid, created_at
+SELECT `+verificationColumns+`
 FROM verifications
 WHERE player_uuid = $1
 ORDER BY created_at DESC
 LIMIT 1
 `, pUUID)
 
-	var v player.Verification
-	if err := row.Scan(&v.ID, &v.PlayerUUID, &v.CreatedAt); err != nil {
+	v, err := scanVerification(row)
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return player.Verification{}, false, nil
 		}
 		return player.Verification{}, false, err
 	}
 
-	emails, err := db.VerificationEmails(v.ID)
+	v, err = db.withEmails(ctx, v)
 	if err != nil {
 		return player.Verification{}, false, err
 	}
-	v.Emails = emails
 
-	for _, email := range emails {
-		if email.VerifiedAt != nil {
-			v.IsVerified = true
-			break
+	return v, true, nil
+}
+
+func (db *DB) Verification(ctx context.Context, pUUID string, vID uint64) (player.Verification, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	row := db.QueryRow(ctx, `
+SELECT `+verificationColumns+`
+FROM verifications
+WHERE player_uuid = $1
+AND id = $2
+`, pUUID, vID)
+
+	v, err := scanVerification(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return player.Verification{}, false, nil
 		}
+		return player.Verification{}, false, err
+	}
+
+	v, err = db.withEmails(ctx, v)
+	if err != nil {
+		return player.Verification{}, false, err
 	}
 
 	return v, true, nil
 }
 
-func (db *DB) HasVerification(pUUID string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) HasVerification(ctx context.Context, pUUID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	res, err := db.Exec(ctx, `
@@ -58,14 +119,15 @@ WHERE player_uuid = $1;
 	return res.RowsAffected() > 0, err
 }
 
-func (db *DB) Verifications(pUUID string) ([]player.Verification, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) Verifications(ctx context.Context, pUUID string) ([]player.Verification, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	rows, err := db.Query(ctx, `
-SELECT id, player_uuid, created_at
+SELECT `+verificationColumns+`
 FROM verifications
 WHERE player_uuid = $1
+ORDER BY created_at
 `, pUUID)
 	if err != nil {
 		return nil, err
@@ -73,37 +135,30 @@ WHERE player_uuid = $1
 
 	var vv []player.Verification
 	for rows.Next() {
-		var v player.Verification
-		if err := rows.Scan(&v.ID, &v.PlayerUUID, &v.CreatedAt); err != nil {
+		v, err := scanVerification(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		emails, err := db.VerificationEmails(v.ID)
+		v, err = db.withEmails(ctx, v)
 		if err != nil {
 			return nil, err
 		}
-		v.Emails = emails
-
-		for _, email := range emails {
-			if email.VerifiedAt != nil {
-				v.IsVerified = true
-				break
-			}
-		}
 
 		vv = append(vv, v)
 	}
-	return vv, nil
+	return vv, rows.Err()
 }
 
-func (db *DB) VerificationEmails(vID uint64) ([]player.VerificationEmail, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) VerificationEmails(ctx context.Context, vID uint64) ([]player.VerificationEmail, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	rows, err := db.Query(ctx, `
-SELECT email, verified_at, created_at
+SELECT email, locale, verified_at, bounced_at, bounce_reason, complained_at, complaint_type, created_at
 FROM verification_emails
 WHERE verification_id = $1
+ORDER BY created_at
 `, vID)
 	if err != nil {
 		return nil, err
@@ -113,7 +168,7 @@ WHERE verification_id = $1
 	for rows.Next() {
 		var e player.VerificationEmail
 		verifiedAt := &time.Time{}
-		if err := rows.Scan(&e.Email, &verifiedAt, &e.CreatedAt); err != nil {
+		if err := rows.Scan(&e.Email, &e.Locale, &verifiedAt, &e.BouncedAt, &e.BounceReason, &e.ComplainedAt, &e.ComplaintType, &e.CreatedAt); err != nil {
 			return nil, err
 		}
 		if verifiedAt != nil {
@@ -124,40 +179,394 @@ WHERE verification_id = $1
 	return ee, nil
 }
 
-func (db *DB) CreateVerification(v *player.Verification) error {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+func (db *DB) CreateVerification(ctx context.Context, v *player.Verification) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	return db.QueryRow(ctx, `
 INSERT INTO verifications
 (player_uuid)
 VALUES ($1)
-RETURNING id, created_at;
+RETURNING id, method, created_at;
 `, v.PlayerUUID).
-		Scan(&v.ID, &v.CreatedAt)
+		Scan(&v.ID, &v.Method, &v.CreatedAt)
 }
 
-func (db *DB) CreateEmailVerification(v player.VerificationEmail) error {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+// CreateManualVerification creates a verification that is verified
+// without an email.
+func (db *DB) CreateManualVerification(ctx context.Context, v *player.Verification) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	return db.QueryRow(ctx, `
+INSERT INTO verifications
+(player_uuid, method, reason, verified_at, verified_by, verified_on_behalf_of)
+VALUES ($1, $2, $3, CURRENT_TIMESTAMP, $4, $5)
+RETURNING id, verified_at, created_at;
+`, v.PlayerUUID, player.MethodManual, v.Reason, v.VerifiedBy, v.VerifiedOnBehalfOf).
+		Scan(&v.ID, &v.VerifiedAt, &v.CreatedAt)
+}
+
+// RevokeVerification marks the verification as revoked. It reports false
+// if the verification does not exist or was already revoked.
+func (db *DB) RevokeVerification(ctx context.Context, vID uint64, by string, onBehalfOf string, reason string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	res, err := db.Exec(ctx, `
+UPDATE verifications
+SET revoked_at = CURRENT_TIMESTAMP, revoked_by = $2, revoked_on_behalf_of = $3, revoke_reason = $4
+WHERE id = $1
+AND revoked_at IS NULL;
+`, vID, by, onBehalfOf, reason)
+	return res.RowsAffected() == 1, err
+}
+
+func (db *DB) CreateEmailVerification(ctx context.Context, v player.VerificationEmail) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
 	_, err := db.Exec(ctx, `
 INSERT INTO verification_emails
-(verification_id, code, email, expires_at)
-VALUES ($1, $2, $3, $4);
-`, v.VerificationID, v.Code, v.Email, v.ExpiresAt)
+(verification_id, code, email, locale, message_id, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+`, v.VerificationID, v.Code, v.Email, v.Locale, v.MessageID, v.ExpiresAt)
 	return err
 }
 
-func (db *DB) VerifyVerification(vID uint64, code string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.Timeout)
+// DeleteEmailVerification deletes an email that was never sent.
+func (db *DB) DeleteEmailVerification(ctx context.Context, vID uint64, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
 	defer cancel()
 
-	res, err := db.Exec(ctx, `
+	_, err := db.Exec(ctx, `
+DELETE FROM verification_emails
+WHERE verification_id = $1
+AND code = $2;
+`, vID, code)
+	return err
+}
+
+// DeleteVerification deletes a verification and its emails that were
+// never sent.
+func (db *DB) DeleteVerification(ctx context.Context, vID uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+DELETE FROM verification_emails
+WHERE verification_id = $1;
+`, vID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+DELETE FROM verifications
+WHERE id = $1;
+`, vID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BounceVerificationEmail marks the email with messageID as bounced. If
+// messageID is empty, the latest email sent to recipient is marked. It
+// reports false if there is no such email or it already bounced.
+func (db *DB) BounceVerificationEmail(ctx context.Context, messageID string, recipient string, reason string) (player.BouncedEmail, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	var b player.BouncedEmail
+	err := db.QueryRow(ctx, `
+UPDATE verification_emails e
+SET bounced_at = CURRENT_TIMESTAMP, bounce_reason = $3
+FROM verifications v
+WHERE e.id = (
+	SELECT id
+	FROM verification_emails
+	WHERE CASE WHEN $1::TEXT <> '' THEN message_id = $1::TEXT ELSE LOWER(email) = LOWER($2) END
+	ORDER BY created_at DESC
+	LIMIT 1
+)
+AND e.verification_id = v.id
+AND e.bounced_at IS NULL
+RETURNING v.player_uuid, e.verification_id, e.email, e.locale, e.bounced_at, e.bounce_reason, e.created_at;
+`, messageID, recipient, reason).
+		Scan(&b.PlayerUUID, &b.VerificationID, &b.Email, &b.Locale, &b.BouncedAt, &b.BounceReason, &b.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return player.BouncedEmail{}, false, nil
+	}
+	if err != nil {
+		return player.BouncedEmail{}, false, err
+	}
+	return b, true, nil
+}
+
+// ComplainVerificationEmail marks the email with messageID, or without
+// messageID the latest email sent to recipient, as complained about. It
+// reports false if there is no such email or it was already complained
+// about.
+func (db *DB) ComplainVerificationEmail(ctx context.Context, messageID string, recipient string, feedbackType string) (player.BouncedEmail, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	var b player.BouncedEmail
+	err := db.QueryRow(ctx, `
+UPDATE verification_emails e
+SET complained_at = CURRENT_TIMESTAMP, complaint_type = $3
+FROM verifications v
+WHERE e.id = (
+	SELECT id
+	FROM verification_emails
+	WHERE CASE WHEN $1::TEXT <> '' THEN message_id = $1::TEXT ELSE LOWER(email) = LOWER($2) END
+	ORDER BY created_at DESC
+	LIMIT 1
+)
+AND e.verification_id = v.id
+AND e.complained_at IS NULL
+RETURNING v.player_uuid, e.verification_id, e.email, e.locale, e.complained_at, e.complaint_type, e.created_at;
+`, messageID, recipient, feedbackType).
+		Scan(&b.PlayerUUID, &b.VerificationID, &b.Email, &b.Locale, &b.ComplainedAt, &b.ComplaintType, &b.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return player.BouncedEmail{}, false, nil
+	}
+	if err != nil {
+		return player.BouncedEmail{}, false, err
+	}
+	return b, true, nil
+}
+
+// VerifyVerification marks the email with code as verified and returns
+// it. It reports false if no unexpired email has the code.
+func (db *DB) VerifyVerification(ctx context.Context, vID uint64, code string) (player.VerificationEmail, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	var e player.VerificationEmail
+	err := db.QueryRow(ctx, `
 UPDATE verification_emails
 SET verified_at = CURRENT_TIMESTAMP
 WHERE verification_id = $1
-AND LOWER(code) = LOWER($2);
-`, vID, code)
-	return res.RowsAffected() == 1, err
+AND LOWER(code) = LOWER($2)
+AND expires_at > CURRENT_TIMESTAMP
+RETURNING verification_id, email, locale, verified_at, created_at;
+`, vID, code).
+		Scan(&e.VerificationID, &e.Email, &e.Locale, &e.VerifiedAt, &e.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return player.VerificationEmail{}, false, nil
+	}
+	if err != nil {
+		return player.VerificationEmail{}, false, err
+	}
+	return e, true, nil
+}
+
+// UnverifyVerification resets the verification and all of its verified
+// emails, so that manual verifications are reset as well.
+func (db *DB) UnverifyVerification(ctx context.Context, vID uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+UPDATE verifications
+SET verified_at = NULL, verified_by = '', verified_on_behalf_of = ''
+WHERE id = $1;
+`, vID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+UPDATE verification_emails
+SET verified_at = NULL
+WHERE verification_id = $1;
+`, vID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ExpireVerification marks the verification and all of its codes as
+// expired, so that the player has to start a new verification.
+func (db *DB) ExpireVerification(ctx context.Context, vID uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+UPDATE verifications
+SET expired_at = CURRENT_TIMESTAMP
+WHERE id = $1
+AND expired_at IS NULL;
+`, vID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+UPDATE verification_emails
+SET expires_at = CURRENT_TIMESTAMP
+WHERE verification_id = $1
+AND expires_at > CURRENT_TIMESTAMP;
+`, vID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ExpireVerifications records the expiry of up to limit verifications
+// older than validity and returns them. Expired are the latest
+// verifications of players that were verified by email and are neither
+// expired nor revoked yet. Their expiry is the end of the validity.
+func (db *DB) ExpireVerifications(ctx context.Context, validity time.Duration, limit int) ([]player.Verification, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+WITH expired AS (
+	UPDATE verifications
+	SET expired_at = created_at + make_interval(secs => $1)
+	WHERE id IN (
+		SELECT lv.id
+		FROM verifications lv
+		WHERE lv.method = $3
+		AND lv.expired_at IS NULL
+		AND lv.revoked_at IS NULL
+		AND lv.created_at + make_interval(secs => $1) <= CURRENT_TIMESTAMP
+		AND lv.created_at = (
+			SELECT MAX(created_at)
+			FROM verifications
+			WHERE player_uuid = lv.player_uuid
+		)
+		AND EXISTS (
+			SELECT 1
+			FROM verification_emails
+			WHERE verification_id = lv.id
+			AND verified_at IS NOT NULL
+		)
+		ORDER BY lv.created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+verificationColumns+`
+), codes AS (
+	UPDATE verification_emails e
+	SET expires_at = CURRENT_TIMESTAMP
+	FROM expired
+	WHERE e.verification_id = expired.id
+	AND e.expires_at > CURRENT_TIMESTAMP
+)
+SELECT `+verificationColumns+`
+FROM expired;
+`, validity.Seconds(), limit, player.MethodEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vv []player.Verification
+	for rows.Next() {
+		v, err := scanVerification(rows)
+		if err != nil {
+			return nil, err
+		}
+		vv = append(vv, v)
+	}
+	return vv, rows.Err()
+}
+
+// ClaimExpiryReminders marks up to limit verifications as reminded and
+// returns them. Claimed are the latest verifications of players that
+// were verified by email, are neither expired nor revoked and whose
+// validity ends within before. The reminder goes to the address verified
+// last.
+func (db *DB) ClaimExpiryReminders(ctx context.Context, validity time.Duration, before time.Duration, limit int) ([]player.ExpiringVerification, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+UPDATE verifications v
+SET reminded_at = CURRENT_TIMESTAMP
+FROM players p, verification_emails e
+WHERE v.id IN (
+	SELECT lv.id
+	FROM verifications lv
+	WHERE lv.method = $4
+	AND lv.reminded_at IS NULL
+	AND lv.expired_at IS NULL
+	AND lv.revoked_at IS NULL
+	AND lv.created_at + make_interval(secs => $1) > CURRENT_TIMESTAMP
+	AND lv.created_at + make_interval(secs => $1) <= CURRENT_TIMESTAMP + make_interval(secs => $2)
+	AND lv.created_at = (
+		SELECT MAX(created_at)
+		FROM verifications
+		WHERE player_uuid = lv.player_uuid
+	)
+	AND EXISTS (
+		SELECT 1
+		FROM verification_emails
+		WHERE verification_id = lv.id
+		AND verified_at IS NOT NULL
+	)
+	ORDER BY lv.created_at
+	LIMIT $3
+	FOR UPDATE SKIP LOCKED
+)
+AND p.uuid = v.player_uuid
+AND e.id = (
+	SELECT id
+	FROM verification_emails
+	WHERE verification_id = v.id
+	AND verified_at IS NOT NULL
+	ORDER BY verified_at DESC
+	LIMIT 1
+)
+RETURNING v.player_uuid, p.username, v.id, e.email, e.locale, v.created_at + make_interval(secs => $1);
+`, validity.Seconds(), before.Seconds(), limit, player.MethodEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expiring []player.ExpiringVerification
+	for rows.Next() {
+		var e player.ExpiringVerification
+		if err := rows.Scan(&e.PlayerUUID, &e.Username, &e.VerificationID, &e.Email, &e.Locale, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, e)
+	}
+	return expiring, rows.Err()
+}
+
+// ReleaseExpiryReminder resets a claimed reminder that was not sent, so
+// that it is claimed again.
+func (db *DB) ReleaseExpiryReminder(ctx context.Context, vID uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	_, err := db.Exec(ctx, `
+UPDATE verifications
+SET reminded_at = NULL
+WHERE id = $1;
+`, vID)
+	return err
 }
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/webhook"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/net/context"
+)
+
+const webhookDeliveryColumns = `
+id, subscription, event_id, event_type, payload, status, attempts,
+last_status_code, last_error, next_attempt_at, delivered_at, created_at
+`
+
+func scanWebhookDelivery(row pgx.Row) (webhook.Delivery, error) {
+	var d webhook.Delivery
+	var payload []byte
+	err := row.Scan(&d.ID, &d.Subscription, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.LastStatusCode, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+	d.Payload = payload
+	return d, err
+}
+
+func (db *DB) CreateWebhookDelivery(ctx context.Context, d *webhook.Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	row := db.QueryRow(ctx, `
+INSERT INTO webhook_deliveries (subscription, event_id, event_type, payload)
+VALUES ($1, $2, $3, $4::JSONB)
+RETURNING `+webhookDeliveryColumns,
+		d.Subscription, d.EventID, d.EventType, string(d.Payload))
+
+	created, err := scanWebhookDelivery(row)
+	if err != nil {
+		return err
+	}
+	*d = created
+	return nil
+}
+
+func (db *DB) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `
+UPDATE webhook_deliveries
+SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+WHERE id IN (
+	SELECT id
+	FROM webhook_deliveries
+	WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+	ORDER BY next_attempt_at
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING `+webhookDeliveryColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (db *DB) UpdateWebhookDelivery(ctx context.Context, d webhook.Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	_, err := db.Exec(ctx, `
+UPDATE webhook_deliveries
+SET status = $2, attempts = $3, last_status_code = $4, last_error = $5,
+	next_attempt_at = $6, delivered_at = $7
+WHERE id = $1
+`, d.ID, d.Status, d.Attempts, d.LastStatusCode, d.LastError, d.NextAttemptAt, d.DeliveredAt)
+	return err
+}
+
+func (db *DB) WebhookDelivery(ctx context.Context, id uint64) (webhook.Delivery, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	row := db.QueryRow(ctx, `
+SELECT `+webhookDeliveryColumns+`
+FROM webhook_deliveries
+WHERE id = $1
+`, id)
+
+	d, err := scanWebhookDelivery(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return webhook.Delivery{}, false, nil
+		}
+		return webhook.Delivery{}, false, err
+	}
+	return d, true, nil
+}
+
+func (db *DB) WebhookDeliveries(ctx context.Context, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.Timeout)
+	defer cancel()
+
+	// LIMIT NULL returns all rows
+	var limit interface{}
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+
+	rows, err := db.Query(ctx, `
+SELECT `+webhookDeliveryColumns+`
+FROM webhook_deliveries
+WHERE ($1 = '' OR subscription = $1)
+	AND ($2 = '' OR event_type = $2)
+	AND ($3 = '' OR status = $3)
+ORDER BY created_at DESC, id DESC
+LIMIT $4 OFFSET $5
+`, filter.Subscription, filter.EventType, filter.Status, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
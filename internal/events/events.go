@@ -0,0 +1,220 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TypePlayerCreated         = "player.created"
+	TypeVerificationEmailSent = "verification.email_sent"
+	TypeVerificationBounced   = "verification.email_bounced"
+	TypeVerificationCompleted = "verification.completed"
+	TypeVerificationExpired   = "verification.expired"
+	TypeVerificationRevoked   = "verification.revoked"
+)
+
+// Types are all lifecycle events.
+var Types = []string{
+	TypePlayerCreated,
+	TypeVerificationEmailSent,
+	TypeVerificationBounced,
+	TypeVerificationCompleted,
+	TypeVerificationExpired,
+	TypeVerificationRevoked,
+}
+
+// Event is a change of a player or its verifications.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      Data      `json:"data"`
+}
+
+// Data is the payload of all lifecycle events.
+type Data struct {
+	PlayerUUID     string `json:"playerUuid"`
+	Username       string `json:"username,omitempty"`
+	VerificationID uint64 `json:"verificationId,omitempty"`
+	Method         string `json:"method,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+func New(eventType string, data Data) (Event, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:        hex.EncodeToString(b),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}, nil
+}
+
+// Transport distributes events between the replicas of the service.
+type Transport interface {
+	Notify(ctx context.Context, payload []byte) error
+	// Listen calls fn for every notification until ctx is done
+	// or the connection fails.
+	Listen(ctx context.Context, fn func(payload []byte)) error
+}
+
+// subscriptionBuffer is the number of events a subscriber may lag
+// behind before events are dropped for it.
+const subscriptionBuffer = 32
+
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	filter func(Event) bool
+	bus    *Bus
+}
+
+// Close stops the delivery of events to the subscription.
+// C is not closed.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	delete(s.bus.subs, s)
+}
+
+// Bus passes events to the subscribers of this process. With a Transport
+// events are published through it, so subscribers of all replicas
+// receive them; Run has to be running to receive them.
+type Bus struct {
+	transport Transport
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus returns a Bus. transport may be nil for a single instance.
+func NewBus(transport Transport) *Bus {
+	return &Bus{
+		transport: transport,
+		subs:      map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe returns a subscription receiving the events filter
+// returns true for, or all events if filter is nil.
+func (b *Bus) Subscribe(filter func(Event) bool) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, filter: filter, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close closes the channels of all subscriptions, which ends the
+// streams of connected clients, e.g. on shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.c)
+		delete(b.subs, sub)
+	}
+}
+
+// Publish passes e to the subscribers. Failures are logged instead of
+// returned, as the event has already happened. A nil Bus discards
+// all events.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+
+	if b.transport == nil {
+		b.dispatch(e)
+		return
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("event_type", e.Type).Msg("Failed encoding event")
+		return
+	}
+
+	if err := b.transport.Notify(ctx, payload); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("event_type", e.Type).Msg("Failed publishing event")
+	}
+}
+
+func (b *Bus) dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+
+		select {
+		case sub.c <- e:
+		default:
+			log.Warn().Str("event_type", e.Type).Msg("Dropped event for slow subscriber")
+		}
+	}
+}
+
+// Run receives the events of the transport until ctx is done and
+// reconnects if the connection fails. It returns immediately without
+// a transport.
+func (b *Bus) Run(ctx context.Context) {
+	if b.transport == nil {
+		return
+	}
+
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := b.transport.Listen(ctx, func(payload []byte) {
+			var e Event
+			if err := json.Unmarshal(payload, &e); err != nil {
+				log.Error().Err(err).Msg("Failed decoding event")
+				return
+			}
+			b.dispatch(e)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		log.Error().Err(err).Dur("retry_in", backoff).Msg("Lost event transport connection")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies.
+const heartbeatInterval = 15 * time.Second
+
+// reconnectDelay is the delay clients wait before reconnecting
+// after a stream ended.
+const reconnectDelay = 3 * time.Second
+
+// writeTimeout replaces the write timeout of the server for streams, so
+// they stay open while clients that stopped reading are still dropped.
+const writeTimeout = 2 * heartbeatInterval
+
+// Stream writes Server-Sent Events to a client.
+type Stream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	rc      *http.ResponseController
+}
+
+// NewStream sends the headers of an event stream.
+func NewStream(w http.ResponseWriter) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	s := &Stream{w: w, flusher: flusher, rc: http.NewResponseController(w)}
+	if err := s.extendDeadline(); err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds()); err != nil {
+		return nil, err
+	}
+	flusher.Flush()
+
+	return s, nil
+}
+
+// extendDeadline gives the next write writeTimeout to complete. Writers
+// without deadlines are left as they are.
+func (s *Stream) extendDeadline() error {
+	err := s.rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// Send writes data as JSON encoded event of eventType.
+func (s *Stream) Send(id string, eventType string, data interface{}) error {
+	bb, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := s.extendDeadline(); err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(s.w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", eventType, bb); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Serve sends the events of sub until the client disconnects, the bus
+// is closed or maxDuration passed, if set. Clients reconnect afterwards.
+func (s *Stream) Serve(r *http.Request, sub *Subscription, maxDuration time.Duration) {
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	var timeout <-chan time.Time
+	if maxDuration > 0 {
+		timer := time.NewTimer(maxDuration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout:
+			return
+		case <-heartbeat.C:
+			if err := s.extendDeadline(); err != nil {
+				return
+			}
+			if _, err := fmt.Fprint(s.w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			s.flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := s.Send(e.ID, e.Type, e); err != nil {
+				logging.FromRequest(r).Debug().Err(err).Msg("Failed sending event")
+				return
+			}
+		}
+	}
+}
+
+// StreamHandler streams all events.
+func StreamHandler(bus *Bus, maxDuration time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub := bus.Subscribe(nil)
+		defer sub.Close()
+
+		stream, err := NewStream(w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stream.Serve(r, sub, maxDuration)
+	}
+}
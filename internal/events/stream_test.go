@@ -0,0 +1,45 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	bus := NewBus(nil)
+	defer bus.Close()
+
+	srv := httptest.NewUnstartedServer(StreamHandler(bus, 0))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(3 * srv.Config.WriteTimeout)
+	e, err := New(TypeVerificationCompleted, Data{PlayerUUID: "8667ba71-b85a-4004-af54-457a9734eed7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(context.Background(), e)
+
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "event: ") {
+			if got := strings.TrimPrefix(lines.Text(), "event: "); got != TypeVerificationCompleted {
+				t.Errorf("event = %s, want %s", got, TypeVerificationCompleted)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended before the event: %v", lines.Err())
+}
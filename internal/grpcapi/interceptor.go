@@ -0,0 +1,101 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// RequestInterceptor attaches the request ID, client IP and a request
+// scoped logger to the context, like the HTTP middlewares do, and logs
+// every call once it has been served.
+func RequestInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	reqID := firstMetadata(md, "x-request-id")
+	if reqID == "" {
+		reqID = fmt.Sprintf("grpc-%06d", middleware.NextRequestID())
+	}
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, reqID)
+
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	ctx = audit.WithIP(ctx, ip)
+
+	logger := log.With().
+		Str("request_id", reqID).
+		Str("grpc_method", info.FullMethod).
+		Logger()
+	ctx = logging.WithRequestLogger(ctx, logger)
+
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	event := logging.RequestLogger(ctx).Info()
+	if code == codes.Internal || code == codes.Unknown {
+		event = logging.RequestLogger(ctx).Warn()
+	}
+	event.
+		Str("remote_ip", ip).
+		Str("code", code.String()).
+		Dur("duration", time.Since(start)).
+		Msg("Served request")
+
+	return resp, err
+}
+
+func secretFromMetadata(md metadata.MD) string {
+	if key := firstMetadata(md, "x-api-key"); key != "" {
+		return key
+	}
+
+	const prefix = "bearer "
+	header := firstMetadata(md, "authorization")
+	if len(header) > len(prefix) && strings.ToLower(header[:len(prefix)]) == prefix {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+// AuthInterceptor authenticates calls with the API keys of the REST API,
+// sent in the authorization (Bearer) or x-api-key metadata.
+func AuthInterceptor(keys func() []auth.Key, required func() bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx, err := auth.Authenticate(ctx, keys(), secretFromMetadata(md), required())
+		switch {
+		case errors.Is(err, auth.ErrKeyRequired):
+			return nil, status.Error(codes.Unauthenticated, "API key required")
+		case errors.Is(err, auth.ErrInvalidKey):
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		return handler(ctx, req)
+	}
+}
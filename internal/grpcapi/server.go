@@ -0,0 +1,227 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	pb "github.com/hhn-mc/mailverifier/api/mailverifier/v1"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/player"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements the gRPC API on top of the player service
+// shared with the REST handlers.
+type Server struct {
+	pb.UnimplementedMailVerifierServiceServer
+
+	Svc *player.Service
+}
+
+// toStatus maps the errors of the player service to gRPC status codes.
+func toStatus(ctx context.Context, err error, msg string) error {
+	var validationErr player.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, player.ErrPlayerNotFound),
+		errors.Is(err, player.ErrVerificationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, player.ErrPlayerExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, player.ErrMaxEmailTries),
+		errors.Is(err, mailer.ErrRateLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, player.ErrNoPendingVerification),
+		errors.Is(err, player.ErrNoEmail),
+		errors.Is(err, player.ErrAlreadyRevoked),
+		errors.Is(err, player.ErrAlreadyVerified):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, player.ErrInvalidCode):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	logging.Ctx(ctx).Error().Err(err).Msg(msg)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func validateUUID(field string, uuid string) error {
+	if err := validation.Validate(uuid, validation.Required, is.UUIDv4); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s: %s", field, err)
+	}
+	return nil
+}
+
+func (s *Server) CreatePlayer(ctx context.Context, req *pb.CreatePlayerRequest) (*pb.Player, error) {
+	p := player.Player{UUID: req.Uuid, Username: req.Username}
+	if err := s.Svc.CreatePlayer(ctx, &p); err != nil {
+		return nil, toStatus(ctx, err, "Failed creating player")
+	}
+	return toPlayer(p), nil
+}
+
+func (s *Server) GetPlayer(ctx context.Context, req *pb.GetPlayerRequest) (*pb.Player, error) {
+	if err := validateUUID("uuid", req.Uuid); err != nil {
+		return nil, err
+	}
+
+	p, err := s.Svc.Player(ctx, req.Uuid)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed getting player")
+	}
+	return toPlayer(p), nil
+}
+
+func (s *Server) ListPlayers(ctx context.Context, req *pb.ListPlayersRequest) (*pb.ListPlayersResponse, error) {
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	filter := player.PlayerFilter{Limit: int(req.Limit), Offset: int(req.Offset)}
+	switch req.Status {
+	case pb.PlayerStatus_PLAYER_STATUS_UNSPECIFIED:
+	case pb.PlayerStatus_PLAYER_STATUS_VERIFIED, pb.PlayerStatus_PLAYER_STATUS_UNVERIFIED:
+		verified := req.Status == pb.PlayerStatus_PLAYER_STATUS_VERIFIED
+		filter.Verified = &verified
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown status %s", req.Status)
+	}
+
+	players, err := s.Svc.Players(ctx, filter)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed listing players")
+	}
+
+	resp := &pb.ListPlayersResponse{Players: make([]*pb.Player, len(players))}
+	for i, p := range players {
+		resp.Players[i] = toPlayer(p)
+	}
+	return resp, nil
+}
+
+// player returns the player of a verification request.
+func (s *Server) player(ctx context.Context, uuid string) (player.Player, error) {
+	if err := validateUUID("player_uuid", uuid); err != nil {
+		return player.Player{}, err
+	}
+
+	p, err := s.Svc.Player(ctx, uuid)
+	if err != nil {
+		return player.Player{}, toStatus(ctx, err, "Failed getting player")
+	}
+	return p, nil
+}
+
+func (s *Server) CreateVerification(ctx context.Context, req *pb.CreateVerificationRequest) (*pb.Verification, error) {
+	if _, err := s.player(ctx, req.PlayerUuid); err != nil {
+		return nil, err
+	}
+
+	v, err := s.Svc.CreateVerification(ctx, req.PlayerUuid)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed creating verification")
+	}
+	return toVerification(v), nil
+}
+
+func (s *Server) ListVerifications(ctx context.Context, req *pb.ListVerificationsRequest) (*pb.ListVerificationsResponse, error) {
+	if _, err := s.player(ctx, req.PlayerUuid); err != nil {
+		return nil, err
+	}
+
+	verifications, err := s.Svc.Verifications(ctx, req.PlayerUuid)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed getting verifications")
+	}
+
+	resp := &pb.ListVerificationsResponse{Verifications: make([]*pb.Verification, len(verifications))}
+	for i, v := range verifications {
+		resp.Verifications[i] = toVerification(v)
+	}
+	return resp, nil
+}
+
+func (s *Server) SendVerificationEmail(ctx context.Context, req *pb.SendVerificationEmailRequest) (*pb.VerificationEmail, error) {
+	p, err := s.player(ctx, req.PlayerUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	ve, err := s.Svc.SendVerificationEmail(ctx, p, req.Email, req.Locale)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed sending verification email")
+	}
+	return toVerificationEmail(ve), nil
+}
+
+func (s *Server) Verify(ctx context.Context, req *pb.VerifyRequest) (*pb.Verification, error) {
+	if _, err := s.player(ctx, req.PlayerUuid); err != nil {
+		return nil, err
+	}
+
+	v, err := s.Svc.Verify(ctx, req.PlayerUuid, req.Code)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed verifying player")
+	}
+	return toVerification(v), nil
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func toPlayer(p player.Player) *pb.Player {
+	return &pb.Player{
+		Uuid:       p.UUID,
+		Username:   p.Username,
+		IsVerified: p.IsVerified,
+		CreatedAt:  timestamppb.New(p.CreatedAt),
+	}
+}
+
+func toVerification(v player.Verification) *pb.Verification {
+	pv := &pb.Verification{
+		Id:                 v.ID,
+		PlayerUuid:         v.PlayerUUID,
+		Method:             v.Method,
+		IsVerified:         v.IsVerified,
+		Reason:             v.Reason,
+		VerifiedAt:         toTimestamp(v.VerifiedAt),
+		VerifiedBy:         v.VerifiedBy,
+		VerifiedOnBehalfOf: v.VerifiedOnBehalfOf,
+		RevokedAt:          toTimestamp(v.RevokedAt),
+		RevokedBy:          v.RevokedBy,
+		RevokedOnBehalfOf:  v.RevokedOnBehalfOf,
+		RevokeReason:       v.RevokeReason,
+		ExpiredAt:          toTimestamp(v.ExpiredAt),
+		CreatedAt:          timestamppb.New(v.CreatedAt),
+	}
+	for _, e := range v.Emails {
+		pv.Emails = append(pv.Emails, toVerificationEmail(e))
+	}
+	return pv
+}
+
+func toVerificationEmail(e player.VerificationEmail) *pb.VerificationEmail {
+	return &pb.VerificationEmail{
+		VerificationId: e.VerificationID,
+		Email:          e.Email,
+		VerifiedAt:     toTimestamp(e.VerifiedAt),
+		ExpiresAt:      toTimestamp(e.ExpiresAt),
+		CreatedAt:      toTimestamp(&e.CreatedAt),
+		BouncedAt:      toTimestamp(e.BouncedAt),
+		BounceReason:   e.BounceReason,
+		Locale:         e.Locale,
+		ComplainedAt:   toTimestamp(e.ComplainedAt),
+		ComplaintType:  e.ComplaintType,
+	}
+}
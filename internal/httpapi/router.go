@@ -0,0 +1,113 @@
+// Package httpapi assembles the REST API from the handlers of the
+// other packages.
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/bounce"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"github.com/hhn-mc/mailverifier/internal/player"
+	"github.com/hhn-mc/mailverifier/internal/tracing"
+	"github.com/hhn-mc/mailverifier/internal/webhook"
+)
+
+// Config holds the dependencies of the router. Admin endpoints whose
+// dependency is nil must not be called.
+type Config struct {
+	Players *player.Service
+	// Repo looks up the players of the /players/{uuid} routes.
+	Repo     player.DataRepo
+	Audit    audit.Repo
+	Webhooks *webhook.Dispatcher
+	Events   *events.Bus
+	Mail     *mailer.Service
+	Bounces  *bounce.Processor
+
+	// Keys and AuthRequired are called for every request, so reloaded
+	// keys take effect immediately.
+	Keys         func() []auth.Key
+	AuthRequired func() bool
+
+	// MetricsPath serves the Prometheus metrics if set.
+	MetricsPath    string
+	MaxBodyBytes   int64
+	StreamDuration time.Duration
+}
+
+// NewRouter returns the handler of the REST API.
+func NewRouter(cfg Config) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(audit.Middleware)
+	r.Use(middleware.Recoverer)
+	if cfg.MaxBodyBytes > 0 {
+		r.Use(maxBodySize(cfg.MaxBodyBytes))
+	}
+	r.Use(metrics.Middleware)
+
+	// Scrapers do not send API keys, so the metrics are not
+	// behind the auth middleware.
+	if cfg.MetricsPath != "" {
+		r.Method(http.MethodGet, cfg.MetricsPath, metrics.Handler())
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(cfg.Keys, cfg.AuthRequired))
+		mountAPI(r, cfg)
+	})
+
+	return r
+}
+
+// mountAPI registers the authenticated routes.
+func mountAPI(r chi.Router, cfg Config) {
+	svc := cfg.Players
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(auth.RequireScope(auth.ScopeAdmin))
+		r.Get("/audit", audit.GetEventsHandler(cfg.Audit))
+		r.Get("/events", events.StreamHandler(cfg.Events, cfg.StreamDuration))
+		r.Get("/webhooks/deliveries", webhook.GetDeliveriesHandler(cfg.Webhooks))
+		r.Post("/webhooks/deliveries/{id}/replay", webhook.PostReplayDeliveryHandler(cfg.Webhooks))
+		r.Get("/templates/{name}/preview", mailer.GetTemplatePreviewHandler(cfg.Mail))
+		r.Post("/bounces", bounce.PostBounceHandler(cfg.Bounces))
+	})
+	r.Route("/players", func(r chi.Router) {
+		r.Get("/{uuid}", player.GetPlayerHandler(svc))
+		r.Post("/", player.PostPlayerHandler(svc))
+		r.Route("/{uuid}/verifications", func(r chi.Router) {
+			r.Use(player.ByUUIDMiddleware(cfg.Repo))
+			r.Get("/", player.GetVerificationsHandler(svc))
+			r.Post("/", player.PostVerificationHandler(svc))
+			r.Post("/verify", player.PostVerificationVerifyHandler(svc))
+			r.With(auth.RequireScope(auth.ScopeAdmin)).Post("/manual", player.PostManualVerificationHandler(svc))
+			r.With(auth.RequireScope(auth.ScopeAdmin)).Post("/{id}/revoke", player.PostRevokeVerificationHandler(svc))
+		})
+		r.With(player.ByUUIDMiddleware(cfg.Repo)).Get("/{uuid}/events", player.GetPlayerEventsHandler(svc, cfg.Events, cfg.StreamDuration))
+		r.Route("/{uuid}/verification-emails", func(r chi.Router) {
+			r.Use(player.ByUUIDMiddleware(cfg.Repo))
+			r.Post("/", player.PostVerificationEmailHandler(svc))
+		})
+	})
+}
+
+// maxBodySize limits the size of request bodies to n bytes.
+func maxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
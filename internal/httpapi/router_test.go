@@ -0,0 +1,32 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hhn-mc/mailverifier/internal/auth"
+)
+
+func TestMetricsWithoutAuth(t *testing.T) {
+	r := NewRouter(Config{
+		Keys:         func() []auth.Key { return []auth.Key{{Name: "test", Key: "secret"}} },
+		AuthRequired: func() bool { return true },
+		MetricsPath:  "/metrics",
+	})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/metrics", http.StatusOK},
+		{"/players/1dd4ab49-a2c8-4f29-8b6a-0e3c2a1b2c3d", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != test.want {
+			t.Errorf("GET %s without API key = %d, want %d", test.path, rec.Code, test.want)
+		}
+	}
+}
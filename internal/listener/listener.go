@@ -0,0 +1,58 @@
+package listener
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixPrefix = "unix:"
+
+// Listen opens a listener for the given bind address. Addresses
+// prefixed with "unix:" are bound as Unix domain socket, everything
+// else is treated as TCP host:port.
+func Listen(bind string) (net.Listener, error) {
+	if !strings.HasPrefix(bind, unixPrefix) {
+		return net.Listen("tcp", bind)
+	}
+
+	path := strings.TrimPrefix(bind, unixPrefix)
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sidecars usually run as a different user in the same group
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes a socket file left behind by a previous
+// process that was not shut down cleanly. Other files are not touched.
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a socket")
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.New(path + " is in use by another process")
+	}
+	return os.Remove(path)
+}
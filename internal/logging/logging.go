@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Privacy modes control how email addresses and secrets appear in logs.
+const (
+	PrivacyPlain  = "plain"
+	PrivacyRedact = "redact"
+	PrivacyHash   = "hash"
+)
+
+const redacted = "[redacted]"
+
+var privacy atomic.Value
+
+func init() {
+	privacy.Store(PrivacyRedact)
+}
+
+type Config struct {
+	Level   string
+	Format  string
+	Privacy string
+}
+
+// Setup configures the global logger from the given config.
+func Setup(cfg Config) error {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		level, err = zerolog.ParseLevel(strings.ToLower(cfg.Level))
+		if err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	switch cfg.Format {
+	case "", FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	switch cfg.Privacy {
+	case "":
+		cfg.Privacy = PrivacyRedact
+	case PrivacyPlain, PrivacyRedact, PrivacyHash:
+	default:
+		return fmt.Errorf("unknown log privacy mode %q", cfg.Privacy)
+	}
+	privacy.Store(cfg.Privacy)
+
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	log.Logger = zerolog.New(w).Level(level).With().Timestamp().Logger()
+	return nil
+}
+
+// Email returns the email address in the form allowed by the privacy mode.
+// Redacted addresses keep their domain since it is rarely personal.
+func Email(email string) string {
+	switch privacy.Load().(string) {
+	case PrivacyPlain:
+		return email
+	case PrivacyHash:
+		return hash(strings.ToLower(email))
+	}
+
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		return redacted + email[i:]
+	}
+	return redacted
+}
+
+// Secret returns the secret in the form allowed by the privacy mode.
+func Secret(secret string) string {
+	switch privacy.Load().(string) {
+	case PrivacyPlain:
+		return secret
+	case PrivacyHash:
+		return hash(secret)
+	}
+	return redacted
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
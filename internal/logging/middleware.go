@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Middleware attaches a request scoped logger carrying the request ID
+// to the context and logs every request once it has been served.
+// It has to be used after middleware.RequestID and middleware.RealIP.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := log.With().
+			Str("request_id", middleware.GetReqID(r.Context())).
+			Logger()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r = r.WithContext(WithRequestLogger(r.Context(), logger))
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// Handlers add fields like player_uuid to their own copy of the
+		// context, which are included in the access log.
+		served := r.WithContext(RequestLogger(r.Context()).WithContext(r.Context()))
+		event := FromRequest(served).Info()
+		if status >= http.StatusInternalServerError {
+			event = FromRequest(served).Warn()
+		}
+		event.
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("remote_ip", r.RemoteAddr).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("duration", time.Since(start)).
+			Msg("Served request")
+	})
+}
+
+// Ctx returns the logger stored in the context or the global logger.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	logger := zerolog.Ctx(ctx)
+	if logger.GetLevel() == zerolog.Disabled {
+		return &log.Logger
+	}
+	return logger
+}
+
+// FromRequest returns the request scoped logger including the
+// route pattern matched so far.
+func FromRequest(r *http.Request) *zerolog.Logger {
+	logger := Ctx(r.Context())
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.RoutePattern() == "" {
+		return logger
+	}
+
+	withRoute := logger.With().Str("route", rctx.RoutePattern()).Logger()
+	return &withRoute
+}
+
+// WithFields returns a copy of ctx whose logger carries the given fields.
+// They are also added to the request logger of ctx.
+func WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	logger := Ctx(ctx).With().Fields(fields).Logger()
+	if req, ok := ctx.Value(ctxRequestLoggerKey).(*requestLogger); ok {
+		req.set(logger)
+	}
+	return logger.WithContext(ctx)
+}
+
+type ctxKey int
+
+const ctxRequestLoggerKey ctxKey = iota
+
+// requestLogger is the logger of a request including the fields added
+// by WithFields in any context derived from the request context.
+type requestLogger struct {
+	mu     sync.Mutex
+	logger zerolog.Logger
+}
+
+func (req *requestLogger) set(logger zerolog.Logger) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.logger = logger
+}
+
+// WithRequestLogger returns a copy of ctx carrying logger as logger and
+// request logger.
+func WithRequestLogger(ctx context.Context, logger zerolog.Logger) context.Context {
+	ctx = context.WithValue(ctx, ctxRequestLoggerKey, &requestLogger{logger: logger})
+	return logger.WithContext(ctx)
+}
+
+// RequestLogger returns the request logger of ctx with all fields added
+// while serving the request, or the logger of ctx without one.
+func RequestLogger(ctx context.Context) *zerolog.Logger {
+	req, ok := ctx.Value(ctxRequestLoggerKey).(*requestLogger)
+	if !ok {
+		return Ctx(ctx)
+	}
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	logger := req.logger
+	return &logger
+}
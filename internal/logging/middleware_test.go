@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestMiddlewareLogsHandlerFields(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = global })
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Route("/players/{uuid}", func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := WithFields(r.Context(), map[string]interface{}{"player_uuid": chi.URLParam(r, "uuid")})
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		})
+		r.Get("/status", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/players/abc/status", nil))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log %q: %v", buf.String(), err)
+	}
+	if entry["message"] != "Served request" || entry["player_uuid"] != "abc" || entry["route"] != "/players/{uuid}/status" {
+		t.Errorf("access log = %v, want player_uuid abc and route /players/{uuid}/status", entry)
+	}
+}
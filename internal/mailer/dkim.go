@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// DefaultDKIMHeaders are signed if DKIMConfig.Headers is empty.
+var DefaultDKIMHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID",
+	"MIME-Version", "Content-Type", "Auto-Submitted",
+}
+
+// DKIMConfig enables DKIM signing if KeyFile is set.
+type DKIMConfig struct {
+	// Domain defaults to the domain of the sender address.
+	Domain   string
+	Selector string
+	// KeyFile is a PEM encoded RSA (PKCS #1 or #8) or Ed25519 (PKCS #8)
+	// private key.
+	KeyFile string
+	Headers []string
+}
+
+// LoadDKIMKey reads the private key in path.
+func LoadDKIMKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s contains no PEM encoded key", path)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("%s: unsupported key type %T, must be RSA or Ed25519", path, key)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %s", path, block.Type)
+	}
+}
+
+// dkimOptions returns the signing options for cfg or nil if signing is
+// disabled. from is the sender address.
+func dkimOptions(cfg DKIMConfig, from string) (*dkim.SignOptions, error) {
+	if cfg.KeyFile == "" {
+		return nil, nil
+	}
+	if cfg.Selector == "" {
+		return nil, errors.New("DKIM selector required")
+	}
+
+	signer, err := LoadDKIMKey(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &dkim.SignOptions{
+		Domain:                 cfg.Domain,
+		Selector:               cfg.Selector,
+		Signer:                 signer,
+		HeaderKeys:             cfg.Headers,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+	}
+	if opts.Domain == "" {
+		opts.Domain = domainOf(from)
+	}
+	if len(opts.HeaderKeys) == 0 {
+		opts.HeaderKeys = DefaultDKIMHeaders
+	}
+	if !containsFold(opts.HeaderKeys, "From") {
+		return nil, errors.New("DKIM headers must contain From")
+	}
+	return opts, nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// signDKIM returns msg with a DKIM-Signature header prepended.
+func signDKIM(msg []byte, opts *dkim.SignOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := dkim.Sign(&buf, bytes.NewReader(msg), opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// writeKey writes key PEM encoded to a file and returns its path.
+func writeKey(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func pkcs8(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// dkimRecord returns the TXT record publishing the public key.
+func dkimRecord(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)
+	}
+	t.Fatalf("unsupported key %T", key)
+	return ""
+}
+
+func verifyDKIM(t *testing.T, msg []byte, records map[string]string) []*dkim.Verification {
+	t.Helper()
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if record, ok := records[domain]; ok {
+				return []string{record}, nil
+			}
+			return nil, fmt.Errorf("no TXT record for %s", domain)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(verifications))
+	}
+	return verifications
+}
+
+func TestDKIMSignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		keyFile string
+	}{
+		{"rsa_pkcs1", rsaKey, writeKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+		{"rsa_pkcs8", rsaKey, writeKey(t, "PRIVATE KEY", pkcs8(t, rsaKey))},
+		{"ed25519", edKey, writeKey(t, "PRIVATE KEY", pkcs8(t, edKey))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := dkimOptions(DKIMConfig{Selector: "mail", KeyFile: test.keyFile}, "noreply@example.com")
+			if err != nil {
+				t.Fatalf("dkimOptions: %v", err)
+			}
+
+			msg := testMessage()
+			msg.Subject = "Account-Verifizierung für Jürgen"
+			bb, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			signed, err := signDKIM(bb, opts)
+			if err != nil {
+				t.Fatalf("signDKIM: %v", err)
+			}
+
+			records := map[string]string{"mail._domainkey.example.com": dkimRecord(t, test.key)}
+			v := verifyDKIM(t, signed, records)[0]
+			if v.Err != nil {
+				t.Fatalf("signature invalid: %v", v.Err)
+			}
+			if v.Domain != "example.com" {
+				t.Errorf("signed domain %s, want example.com", v.Domain)
+			}
+			for _, header := range DefaultDKIMHeaders {
+				if !containsFold(v.HeaderKeys, header) {
+					t.Errorf("header %s not signed", header)
+				}
+			}
+
+			tampered := bytes.Replace(signed, []byte("/verify A1B2C3"), []byte("/verify ZZZZZZ"), 1)
+			if v := verifyDKIM(t, tampered, records)[0]; v.Err == nil {
+				t.Error("signature of tampered body valid")
+			}
+		})
+	}
+}
+
+func TestDKIMOptions(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeKey(t, "PRIVATE KEY", pkcs8(t, key))
+
+	opts, err := dkimOptions(DKIMConfig{Domain: "mail.example.org", Selector: "s1", KeyFile: keyFile, Headers: []string{"from", "Subject"}}, "noreply@example.com")
+	if err != nil {
+		t.Fatalf("dkimOptions: %v", err)
+	}
+	if opts.Domain != "mail.example.org" {
+		t.Errorf("domain %s, want mail.example.org", opts.Domain)
+	}
+
+	if opts, err := dkimOptions(DKIMConfig{}, "noreply@example.com"); opts != nil || err != nil {
+		t.Errorf("dkimOptions without key = %v, %v, want disabled", opts, err)
+	}
+
+	if _, err := dkimOptions(DKIMConfig{Selector: "mail", KeyFile: keyFile, Headers: []string{"To", "Subject"}}, "noreply@example.com"); err == nil {
+		t.Error("headers without From accepted")
+	}
+
+	if _, err := dkimOptions(DKIMConfig{KeyFile: keyFile}, "noreply@example.com"); err == nil {
+		t.Error("missing selector accepted")
+	}
+}
@@ -1,27 +1,23 @@
 package mailer
 
 import (
-	"bytes"
-	_ "embed"
-	"fmt"
-	"html/template"
-	"net/smtp"
-)
-
-//go:embed email_verification.html
-var verificationEmailFile string
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"sync/atomic"
+	"time"
 
-const (
-	verificationEmailTmplName = "verification"
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"github.com/hhn-mc/mailverifier/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var emailTmpls *template.Template
-
-func init() {
-	emailTmpls = template.Must(template.New(verificationEmailTmplName).Parse(verificationEmailFile))
-}
-
-type Service struct {
+type Config struct {
 	Host     string
 	SMTPHost string
 	Email    string
@@ -29,14 +25,246 @@ type Service struct {
 	Identity string
 	Username string
 	Password string
+	// DefaultLocale is used for emails without a requested locale.
+	DefaultLocale string
+	// TemplateDir contains templates overriding the built-in ones.
+	TemplateDir string
+	DKIM        DKIMConfig
+
+	// Security is one of the Security* modes, defaults to
+	// SecuritySTARTTLS.
+	Security string
+	// AuthMechanism is one of the Auth* mechanisms. It defaults to
+	// AuthPlain, or AuthNone without username.
+	AuthMechanism string
+	// CAFile contains PEM encoded certificates to trust instead of the
+	// system roots.
+	CAFile             string
+	InsecureSkipVerify bool
+	// ConnectTimeout limits connecting up to the greeting of the
+	// server, Timeout every following exchange with the server.
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
+
+	// PoolSize is the maximum number of SMTP connections kept open for
+	// reuse. Sends wait for a free connection. Without a pool, every
+	// email opens a new connection.
+	PoolSize int
+	// PoolMaxMessages closes connections after this many emails, as
+	// servers limit the messages per connection. 0 means no limit.
+	PoolMaxMessages int
+	// PoolIdleTimeout closes connections unused for this long.
+	PoolIdleTimeout time.Duration
+
+	RateLimit RateLimitConfig
+}
+
+// Service sends emails with a config and templates that can be
+// swapped at runtime.
+type Service struct {
+	state atomic.Value
+}
+
+// state is everything derived from a Config, swapped at once on reload.
+type state struct {
+	cfg       Config
+	templates *Registry
+	dkim      *dkim.SignOptions
+	tls       *tls.Config
+	// pool is nil if PoolSize is 0.
+	pool *pool
+	// limiter is nil without rate limits.
+	limiter *limiter
 }
 
-func (mail Service) sendEmail(sendTo []string, subject string, msg string) error {
-	auth := smtp.PlainAuth(mail.Identity, mail.Username, mail.Password, mail.Host)
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-	msg = fmt.Sprintf("To: %s\nFrom: %s <%s>\nSubject: %s\n%s\n%s",
-		sendTo, mail.Alias, mail.Email, subject, mime, msg)
-	return smtp.SendMail(mail.SMTPHost, auth, mail.Email, sendTo, []byte(msg))
+func NewService(cfg Config) (*Service, error) {
+	mail := &Service{}
+	if err := mail.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+// Reload replaces the config used for all following emails and reloads
+// the templates, DKIM key and CA file from disk. On error, the current
+// config is kept.
+func (mail *Service) Reload(cfg Config) error {
+	if cfg.Security == "" {
+		cfg.Security = SecuritySTARTTLS
+	}
+
+	st := &state{cfg: cfg}
+	var err error
+	if st.templates, err = LoadRegistry(cfg.TemplateDir); err != nil {
+		return err
+	}
+	if st.dkim, err = dkimOptions(cfg.DKIM, cfg.Email); err != nil {
+		return err
+	}
+	if st.tls, err = newTLSConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.PoolSize > 0 {
+		st.pool = newPool(st)
+	}
+
+	old, _ := mail.state.Load().(*state)
+	switch {
+	case !cfg.RateLimit.enabled():
+	case old != nil && old.limiter != nil && old.cfg.RateLimit == cfg.RateLimit:
+		// Keep the buckets, so reloads do not reset the limits.
+		st.limiter = old.limiter
+	default:
+		st.limiter = newLimiter(cfg.RateLimit)
+	}
+
+	// Connections of the old config are closed once idle.
+	if old != nil && old.pool != nil {
+		old.pool.close()
+	}
+	mail.state.Store(st)
+	return nil
+}
+
+// Close closes all idle SMTP connections.
+func (mail *Service) Close() {
+	if st := mail.current(); st.pool != nil {
+		st.pool.close()
+	}
+}
+
+func (mail *Service) current() *state {
+	return mail.state.Load().(*state)
+}
+
+func (mail *Service) config() Config {
+	return mail.current().cfg
+}
+
+// Templates returns the current templates.
+func (mail *Service) Templates() *Registry {
+	return mail.current().templates
+}
+
+// NewMessageID returns a unique Message-ID for an email from the
+// configured sender.
+func (mail *Service) NewMessageID() (string, error) {
+	return newMessageID(domainOf(mail.config().Email))
+}
+
+// Preview renders the template name with sample data in the preferred
+// locale or else the default locale.
+func (mail *Service) Preview(name string, locale string) (Rendered, error) {
+	return mail.Templates().Preview(name, locale, mail.config().DefaultLocale)
+}
+
+func (mail *Service) sendEmail(ctx context.Context, msg Message) (err error) {
+	st := mail.current()
+	cfg := st.cfg
+	_, span := tracing.Start(ctx, "smtp.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("net.peer.name", cfg.SMTPHost),
+			attribute.Int("smtp.recipients", len(msg.To)),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if st.limiter != nil {
+		if err := st.limiter.wait(ctx, msg.Recipients()); err != nil {
+			return err
+		}
+	}
+
+	msg.From = netmail.Address{Name: cfg.Alias, Address: cfg.Email}
+	bb, err := msg.Bytes()
+	if err != nil {
+		metrics.EmailFailed("template")
+		return err
+	}
+	if st.dkim != nil {
+		if bb, err = signDKIM(bb, st.dkim); err != nil {
+			metrics.EmailFailed("dkim")
+			return err
+		}
+	}
+
+	if err := mail.deliver(ctx, st, cfg.Email, msg.Recipients(), bb); err != nil {
+		metrics.EmailFailed(failureReason(err))
+		return err
+	}
+	metrics.EmailSent()
+	return nil
+}
+
+// deliver sends msg over a pooled connection or in a new SMTP session.
+func (mail *Service) deliver(ctx context.Context, st *state, from string, to []string, msg []byte) error {
+	if st.pool != nil {
+		return st.pool.deliver(ctx, from, to, msg)
+	}
+
+	c, err := dial(ctx, st.cfg, st.tls)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.send(ctx, from, to, msg); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// failureReason maps a send error to a coarse reason used as metric label.
+func failureReason(err error) string {
+	if errors.Is(err, ErrNoSTARTTLS) || errors.Is(err, ErrNoAuth) || errors.Is(err, ErrInsecureAuth) {
+		return "security"
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch {
+		case protoErr.Code == 535:
+			return "auth"
+		case protoErr.Code >= 500:
+			return "rejected"
+		case protoErr.Code >= 400:
+			return "deferred"
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "connection"
+	}
+
+	return "other"
+}
+
+// CheckRateLimit returns a RateLimitError if an email to the recipients
+// would exceed a rate limit now. It does not count as an email, so a
+// following send may still be rate limited.
+func (mail *Service) CheckRateLimit(recipients ...string) error {
+	if st := mail.current(); st.limiter != nil {
+		return st.limiter.check(recipients)
+	}
+	return nil
+}
+
+// Check connects and authenticates to the SMTP server without sending
+// an email.
+func (mail *Service) Check(timeout time.Duration) error {
+	st := mail.current()
+	cfg := st.cfg
+	cfg.ConnectTimeout, cfg.Timeout = timeout, timeout
+
+	c, err := dial(context.Background(), cfg, st.tls)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Quit()
 }
 
 type VerificationEmailData struct {
@@ -44,14 +272,89 @@ type VerificationEmailData struct {
 	Username string
 	UUID     string
 	Time     string
+	// Locale is a locale or an Accept-Language header. The default
+	// locale is used if empty.
+	Locale string
+	// MessageID is generated if empty.
+	MessageID string
+}
+
+func (mail *Service) SendVerificationEmail(ctx context.Context, data VerificationEmailData, sendTo ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "mailer.SendVerificationEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return mail.send(ctx, TemplateVerification, data, data.Locale, data.MessageID, sendTo)
+}
+
+// VerifiedEmailData confirms a completed verification.
+type VerifiedEmailData struct {
+	Username string
+	UUID     string
+	Email    string
+	Time     string
+	Locale   string
 }
 
-func (mail Service) SendVerificationEmail(data VerificationEmailData, sendTo ...string) error {
-	subject := "Account Verification"
-	tmpl := emailTmpls.Lookup(verificationEmailTmplName)
-	w := bytes.NewBuffer([]byte{})
-	if err := tmpl.Execute(w, data); err != nil {
+func (mail *Service) SendVerifiedEmail(ctx context.Context, data VerifiedEmailData, sendTo ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "mailer.SendVerifiedEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return mail.send(ctx, TemplateVerified, data, data.Locale, "", sendTo)
+}
+
+// ExpiryReminderEmailData reminds of a verification that expires soon.
+type ExpiryReminderEmailData struct {
+	Username  string
+	UUID      string
+	Email     string
+	ExpiresAt string
+	// Days until ExpiresAt, rounded up.
+	Days   int
+	Locale string
+}
+
+func (mail *Service) SendExpiryReminderEmail(ctx context.Context, data ExpiryReminderEmailData, sendTo ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "mailer.SendExpiryReminderEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return mail.send(ctx, TemplateExpiryReminder, data, data.Locale, "", sendTo)
+}
+
+// RevokedEmailData informs of a revoked verification.
+type RevokedEmailData struct {
+	Username string
+	UUID     string
+	Email    string
+	Reason   string
+	Time     string
+	Locale   string
+}
+
+func (mail *Service) SendRevokedEmail(ctx context.Context, data RevokedEmailData, sendTo ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "mailer.SendRevokedEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return mail.send(ctx, TemplateRevoked, data, data.Locale, "", sendTo)
+}
+
+// send renders the template name with data in the preferred locale and
+// sends it. An empty messageID is generated.
+func (mail *Service) send(ctx context.Context, name string, data interface{}, locale string, messageID string, sendTo []string) error {
+	rendered, err := mail.Templates().Render(name, data, locale, mail.config().DefaultLocale)
+	if err != nil {
+		metrics.EmailFailed("template")
 		return err
 	}
-	return mail.sendEmail(sendTo, subject, w.String())
+
+	msg := Message{
+		MessageID: messageID,
+		Subject:   rendered.Subject,
+		Text:      rendered.Text,
+		HTML:      rendered.HTML,
+		Headers:   map[string]string{"Auto-Submitted": "auto-generated"},
+	}
+	for _, addr := range sendTo {
+		msg.To = append(msg.To, netmail.Address{Address: addr})
+	}
+	return mail.sendEmail(ctx, msg)
 }
@@ -0,0 +1,351 @@
+package mailer
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCert is a self-signed certificate for example.com and 127.0.0.1.
+var testCert struct {
+	once sync.Once
+	tls  tls.Certificate
+	pem  []byte
+}
+
+func serverCert() (tls.Certificate, []byte) {
+	testCert.once.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "example.com"},
+			DNSNames:              []string{"example.com"},
+			IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		if err != nil {
+			panic(err)
+		}
+		testCert.tls = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+		testCert.pem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	})
+	return testCert.tls, testCert.pem
+}
+
+const (
+	fakeUsername = "admin"
+	fakePassword = "secret"
+	// fakeChallenge is the CRAM-MD5 challenge of the fake server.
+	fakeChallenge = "<1896.697170952@example.com>"
+)
+
+// fakeSMTP is a minimal SMTP server. Options have to be set before
+// start.
+type fakeSMTP struct {
+	// ImplicitTLS speaks TLS from the start, STARTTLS offers upgrading.
+	ImplicitTLS bool
+	STARTTLS    bool
+	// Auth lists the advertised mechanisms like "PLAIN LOGIN".
+	Auth string
+	// MaxMessages per connection, further MAIL commands get 421 and the
+	// connection is closed.
+	MaxMessages int
+	// RefuseMail answers every MAIL with 421 and closes the connection.
+	RefuseMail bool
+	// DropMail fails the first MAIL on a connection that has already
+	// sent a message with "421" or by closing the connection ("eof").
+	DropMail string
+	// GreetingDelay delays the greeting, MailDelay the reply to MAIL.
+	GreetingDelay time.Duration
+	MailDelay     time.Duration
+
+	Addr string
+
+	ln       net.Listener
+	mu       sync.Mutex
+	open     map[net.Conn]bool
+	conns    int
+	messages []fakeMessage
+	auths    []fakeAuth
+	dropped  bool
+}
+
+type fakeMessage struct {
+	From string
+	To   []string
+	Data string
+	TLS  bool
+	// Conn is the number of the connection, starting at 1.
+	Conn int
+}
+
+type fakeAuth struct {
+	Mechanism string
+	Username  string
+	// Valid reports whether the credentials were correct.
+	Valid bool
+	TLS   bool
+}
+
+func (f *fakeSMTP) start(t testing.TB) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ln = ln
+	f.Addr = ln.Addr().String()
+	f.open = map[net.Conn]bool{}
+	t.Cleanup(f.close)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			id := f.conns
+			f.open[conn] = true
+			f.mu.Unlock()
+			go f.serve(conn, id)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) close() {
+	f.ln.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.open {
+		conn.Close()
+	}
+}
+
+func (f *fakeSMTP) connCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func (f *fakeSMTP) sent() []fakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMessage(nil), f.messages...)
+}
+
+func (f *fakeSMTP) authenticated() []fakeAuth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeAuth(nil), f.auths...)
+}
+
+func (f *fakeSMTP) serve(raw net.Conn, id int) {
+	defer func() {
+		raw.Close()
+		f.mu.Lock()
+		delete(f.open, raw)
+		f.mu.Unlock()
+	}()
+
+	cert, _ := serverCert()
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	conn := raw
+	secure := false
+	if f.ImplicitTLS {
+		conn = tls.Server(conn, tlsCfg)
+		secure = true
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	readLine := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	time.Sleep(f.GreetingDelay)
+	reply("220 example.com ESMTP fake")
+
+	var msg fakeMessage
+	sent := 0
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			reply("500 empty command")
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO", "HELO":
+			reply("250-example.com")
+			if f.STARTTLS && !secure {
+				reply("250-STARTTLS")
+			}
+			if f.Auth != "" {
+				reply("250-AUTH %s", f.Auth)
+			}
+			reply("250 8BITMIME")
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, tlsCfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			auth := fakeAuth{Mechanism: strings.ToUpper(fields[1]), TLS: secure}
+			switch auth.Mechanism {
+			case "PLAIN":
+				decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+				parts := strings.Split(string(decoded), "\x00")
+				if len(parts) == 3 {
+					auth.Username = parts[1]
+					auth.Valid = parts[1] == fakeUsername && parts[2] == fakePassword
+				}
+			case "LOGIN":
+				reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+				username, _ := readLine()
+				reply("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+				password, _ := readLine()
+				u, _ := base64.StdEncoding.DecodeString(username)
+				p, _ := base64.StdEncoding.DecodeString(password)
+				auth.Username = string(u)
+				auth.Valid = string(u) == fakeUsername && string(p) == fakePassword
+			case "CRAM-MD5":
+				reply("334 %s", base64.StdEncoding.EncodeToString([]byte(fakeChallenge)))
+				response, _ := readLine()
+				decoded, _ := base64.StdEncoding.DecodeString(response)
+				parts := strings.SplitN(string(decoded), " ", 2)
+				mac := hmac.New(md5.New, []byte(fakePassword))
+				mac.Write([]byte(fakeChallenge))
+				auth.Username = parts[0]
+				auth.Valid = len(parts) == 2 && parts[0] == fakeUsername && parts[1] == hex.EncodeToString(mac.Sum(nil))
+			}
+			f.mu.Lock()
+			f.auths = append(f.auths, auth)
+			f.mu.Unlock()
+			if !auth.Valid {
+				reply("535 authentication failed")
+				continue
+			}
+			reply("235 authenticated")
+		case "MAIL":
+			time.Sleep(f.MailDelay)
+			if f.RefuseMail || f.MaxMessages > 0 && sent >= f.MaxMessages {
+				reply("421 too many messages in this connection")
+				return
+			}
+			f.mu.Lock()
+			drop := f.DropMail != "" && sent > 0 && !f.dropped
+			f.dropped = f.dropped || drop
+			f.mu.Unlock()
+			if drop {
+				if f.DropMail == "421" {
+					reply("421 closing idle connection")
+				}
+				return
+			}
+			msg = fakeMessage{From: pathAddress(line), TLS: secure, Conn: id}
+			reply("250 ok")
+		case "RCPT":
+			msg.To = append(msg.To, pathAddress(line))
+			reply("250 ok")
+		case "DATA":
+			reply("354 end with <CRLF>.<CRLF>")
+			var data strings.Builder
+			for {
+				l, ok := readLine()
+				if !ok {
+					return
+				}
+				if l == "." {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+				data.WriteString("\r\n")
+			}
+			msg.Data = data.String()
+			sent++
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// pathAddress returns the address in MAIL FROM:<a> or RCPT TO:<a>.
+func pathAddress(line string) string {
+	start, end := strings.Index(line, "<"), strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// config returns a config for the fake server that trusts its
+// certificate.
+func (f *fakeSMTP) config(t testing.TB) Config {
+	t.Helper()
+	_, certPEM := serverCert()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		Host:           "example.com",
+		SMTPHost:       f.Addr,
+		Email:          "noreply@example.com",
+		Alias:          "HHN Minecraft",
+		Username:       fakeUsername,
+		Password:       fakePassword,
+		Security:       SecuritySTARTTLS,
+		AuthMechanism:  AuthPlain,
+		CAFile:         caFile,
+		ConnectTimeout: 5 * time.Second,
+		Timeout:        5 * time.Second,
+	}
+}
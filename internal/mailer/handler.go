@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+// GetTemplatePreviewHandler renders a template with sample data in the
+// locale of the query parameter locale or the Accept-Language header.
+// By default the subject and bodies are returned as JSON; format=html or
+// format=text returns only that body for viewing in a browser.
+func GetTemplatePreviewHandler(mail *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale := r.URL.Query().Get("locale")
+		if locale == "" {
+			locale = r.Header.Get("Accept-Language")
+		}
+
+		rendered, err := mail.Preview(chi.URLParam(r, "name"), locale)
+		if errors.Is(err, ErrTemplateNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed rendering template preview")
+			return
+		}
+
+		w.Header().Set("Content-Language", rendered.Locale)
+		switch r.URL.Query().Get("format") {
+		case "":
+			if err := json.NewEncoder(w).Encode(rendered); err != nil {
+				logging.FromRequest(r).Error().Err(err).Msg("Failed encoding template preview")
+			}
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(rendered.HTML))
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(rendered.Text))
+		default:
+			http.Error(w, "format must be html or text", http.StatusBadRequest)
+		}
+	}
+}
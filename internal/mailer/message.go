@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML alternative.
+type Message struct {
+	From    mail.Address
+	To      []mail.Address
+	Subject string
+	// Date and MessageID are set when the message is encoded if empty.
+	Date      time.Time
+	MessageID string
+	Text      string
+	HTML      string
+	// Headers are added to the header of the message.
+	Headers map[string]string
+}
+
+// Recipients returns the addresses of all recipients for the envelope.
+func (m Message) Recipients() []string {
+	rcpts := make([]string, len(m.To))
+	for i, to := range m.To {
+		rcpts[i] = to.Address
+	}
+	return rcpts
+}
+
+// boundarySource provides the randomness of MIME boundaries.
+var boundarySource io.Reader = rand.Reader
+
+// newBoundary returns a random MIME boundary like multipart.Writer.
+func newBoundary() (string, error) {
+	b := make([]byte, 30)
+	if _, err := io.ReadFull(boundarySource, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newMessageID returns a globally unique message ID for the domain.
+func newMessageID(domain string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%s.%s@%s>", time.Now().UTC().Format("20060102150405"), hex.EncodeToString(b), domain), nil
+}
+
+func domainOf(addr string) string {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+// writeHeader writes a header field. Values are not folded; non-ASCII
+// values have to be RFC 2047 encoded by the caller.
+func writeHeader(buf *bytes.Buffer, key string, value string) {
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+// Bytes encodes the message as multipart/alternative MIME message with
+// CRLF line endings and quoted-printable encoded parts.
+func (m Message) Bytes() ([]byte, error) {
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		id, err := newMessageID(domainOf(m.From.Address))
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = id
+	}
+
+	to := make([]string, len(m.To))
+	for i, addr := range m.To {
+		to[i] = addr.String()
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", m.From.String())
+	writeHeader(&buf, "To", strings.Join(to, ", "))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", m.MessageID)
+	keys := make([]string, 0, len(m.Headers))
+	for key := range m.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeHeader(&buf, textproto.CanonicalMIMEHeaderKey(key), mime.QEncoding.Encode("utf-8", m.Headers[key]))
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{
+		"boundary": mw.Boundary(),
+	}))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
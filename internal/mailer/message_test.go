@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// zeroReader makes the MIME boundaries predictable.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func testMessage() Message {
+	return Message{
+		From:      mail.Address{Name: "HHN Minecraft", Address: "noreply@example.com"},
+		To:        []mail.Address{{Address: "steve@example.com"}},
+		Subject:   "Account Verification",
+		Date:      time.Date(2021, 10, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		MessageID: "<20211001100000.0123456789abcdef@example.com>",
+		Text:      "Hello Steve,\n\nplease enter this command:\n\n    /verify A1B2C3\n",
+		HTML:      "<h1>Hello Steve</h1>\n<p>Please enter this command:</p>\n<h2>/verify A1B2C3</h2>\n",
+		Headers:   map[string]string{"Auto-Submitted": "auto-generated"},
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	boundarySource = zeroReader{}
+
+	tests := []struct {
+		name string
+		msg  func(m *Message)
+	}{
+		{"plain", func(m *Message) {}},
+		{"non_ascii", func(m *Message) {
+			m.From.Name = "HHN Minecraft Grüße"
+			m.Subject = "Account-Verifizierung für Jürgen"
+			m.Text = "Hallo Jürgen,\n\nbitte gib dieses Kommando ein:\n\n    /verify A1B2C3\n"
+		}},
+		{"multiple_to", func(m *Message) {
+			m.To = []mail.Address{
+				{Address: "steve@example.com"},
+				{Name: "Alex", Address: "alex@example.com"},
+				{Name: "Zoë", Address: "zoe@example.com"},
+			}
+		}},
+		{"long_lines", func(m *Message) {
+			m.HTML = `<table style="padding: 5px; border-radius: 3px; border: 1px solid darkgrey; color: darkgrey; font-family: sans-serif"><tr><td>Username:</td><td>Steve</td></tr></table>` + "\n"
+		}},
+		{"text_only", func(m *Message) {
+			m.HTML = ""
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := testMessage()
+			test.msg(&msg)
+			got, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+
+			golden := filepath.Join("testdata", test.name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Bytes() differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestMessageBytesCRLF(t *testing.T) {
+	msg := testMessage()
+	msg.Text = "line 1\nline 2\r\nline 3\n"
+	got, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	for i, line := range strings.SplitAfter(string(got), "\n") {
+		if line != "" && !strings.HasSuffix(line, "\r\n") {
+			t.Errorf("line %d %q does not end with CRLF", i+1, line)
+		}
+		if strings.Contains(strings.TrimSuffix(line, "\r\n"), "\r") {
+			t.Errorf("line %d %q contains a bare CR", i+1, line)
+		}
+	}
+}
+
+func TestMessageBytesSoftBreaks(t *testing.T) {
+	msg := testMessage()
+	msg.HTML = strings.Repeat("<p>Long HTML line</p>", 20) + "\n"
+	got, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	body := string(got[bytes.Index(got, []byte("\r\n\r\n")):])
+	softBreaks := 0
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("line longer than 76 characters: %q", line)
+		}
+		if strings.HasSuffix(line, "=") {
+			softBreaks++
+		}
+	}
+	if softBreaks == 0 {
+		t.Error("no quoted-printable soft line breaks")
+	}
+
+	// Decoding reverses the soft breaks.
+	parsed, err := mail.ReadMessage(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if parsed.Header.Get("Message-Id") != msg.MessageID {
+		t.Errorf("Message-ID = %q", parsed.Header.Get("Message-Id"))
+	}
+}
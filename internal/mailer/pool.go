@@ -0,0 +1,175 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// pool keeps authenticated SMTP sessions open for reuse. It holds at
+// most size connections, sends wait until one is free.
+type pool struct {
+	st  *state
+	sem chan struct{}
+
+	mu     sync.Mutex
+	idle   []*pooledConn
+	closed bool
+}
+
+type pooledConn struct {
+	*smtpConn
+	msgs      int
+	idleSince time.Time
+}
+
+func newPool(st *state) *pool {
+	return &pool{
+		st:  st,
+		sem: make(chan struct{}, st.cfg.PoolSize),
+	}
+}
+
+// deliver sends msg over a pooled connection. A send failing on a reused
+// connection before the server accepted the sender, e.g. because the
+// server dropped the idle connection, is retried on a new connection.
+func (p *pool) deliver(ctx context.Context, from string, to []string, msg []byte) error {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	c, reused, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.send(ctx, from, to, msg)
+	if err != nil && reused && isStale(err) {
+		c.Close()
+		if c, err = p.dial(ctx); err != nil {
+			return err
+		}
+		err = c.send(ctx, from, to, msg)
+	}
+	p.put(c, err)
+	return err
+}
+
+func (p *pool) dial(ctx context.Context) (*pooledConn, error) {
+	c, err := dial(ctx, p.st.cfg, p.st.tls)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledConn{smtpConn: c}, nil
+}
+
+// get returns an idle connection that is still alive or a new one.
+func (p *pool) get(ctx context.Context) (*pooledConn, bool, error) {
+	for {
+		c := p.pop()
+		if c == nil {
+			break
+		}
+		if time.Since(c.idleSince) > p.st.cfg.PoolIdleTimeout {
+			c.quit()
+			continue
+		}
+		if err := c.extend(ctx); err != nil {
+			c.Close()
+			continue
+		}
+		// RSET detects connections dropped by the server while idle.
+		if err := c.Reset(); err != nil {
+			c.Close()
+			continue
+		}
+		return c, true, nil
+	}
+
+	c, err := p.dial(ctx)
+	return c, false, err
+}
+
+func (p *pool) pop() *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return nil
+	}
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return c
+}
+
+// put returns c to the pool unless sending failed or the connection
+// reached the maximum number of messages.
+func (p *pool) put(c *pooledConn, err error) {
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	c.msgs++
+	if max := p.st.cfg.PoolMaxMessages; max > 0 && c.msgs >= max {
+		c.quit()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		c.quit()
+		return
+	}
+	c.idleSince = time.Now()
+	p.idle = append(p.idle, c)
+	p.mu.Unlock()
+}
+
+// close quits all idle connections. Connections in use are quit when
+// they are returned.
+func (p *pool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.closed = nil, true
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.quit()
+	}
+}
+
+// quit ends the session politely, but does not wait long for it.
+func (c *pooledConn) quit() {
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	if err := c.Quit(); err != nil {
+		c.Close()
+	}
+}
+
+// isStale reports whether err means that the connection was closed by
+// the server before it accepted the message.
+func isStale(err error) bool {
+	var mailErr mailError
+	if !errors.As(err, &mailErr) {
+		return false
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		// 421 is sent by servers closing the connection, e.g. after
+		// too many messages.
+		return protoErr.Code == 421
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.As(err, &netErr)
+}
@@ -0,0 +1,176 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testMsg = []byte("Subject: Test\r\n\r\nHello\r\n")
+
+// newTestState returns the state for sending to the fake server, with a
+// pool if cfg.PoolSize is set.
+func newTestState(t testing.TB, cfg Config) *state {
+	t.Helper()
+	st := &state{cfg: cfg}
+	var err error
+	if st.tls, err = newTLSConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PoolSize > 0 {
+		st.pool = newPool(st)
+		t.Cleanup(st.pool.close)
+	}
+	return st
+}
+
+func deliverN(t testing.TB, st *state, n int) {
+	t.Helper()
+	mail := &Service{}
+	for i := 0; i < n; i++ {
+		if err := mail.deliver(context.Background(), st, "noreply@example.com", []string{"steve@example.com"}, testMsg); err != nil {
+			t.Fatalf("deliver %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	f := (&fakeSMTP{STARTTLS: true, Auth: "PLAIN"}).start(t)
+	cfg := f.config(t)
+	cfg.PoolSize = 2
+	cfg.PoolIdleTimeout = time.Hour
+
+	deliverN(t, newTestState(t, cfg), 5)
+	if n := f.connCount(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+	if n := len(f.authenticated()); n != 1 {
+		t.Errorf("authenticated %d times, want 1", n)
+	}
+	if n := len(f.sent()); n != 5 {
+		t.Errorf("sent %d messages, want 5", n)
+	}
+}
+
+func TestPoolMaxMessages(t *testing.T) {
+	// The server would refuse a third message per connection.
+	f := (&fakeSMTP{MaxMessages: 2}).start(t)
+	cfg := f.config(t)
+	cfg.AuthMechanism = AuthNone
+	cfg.PoolSize = 1
+	cfg.PoolMaxMessages = 2
+	cfg.PoolIdleTimeout = time.Hour
+
+	deliverN(t, newTestState(t, cfg), 5)
+	if n := f.connCount(); n != 3 {
+		t.Errorf("%d connections, want 3", n)
+	}
+
+	perConn := map[int]int{}
+	for _, msg := range f.sent() {
+		perConn[msg.Conn]++
+	}
+	for conn, n := range perConn {
+		if n > 2 {
+			t.Errorf("connection %d sent %d messages, want at most 2", conn, n)
+		}
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	f := (&fakeSMTP{}).start(t)
+	cfg := f.config(t)
+	cfg.AuthMechanism = AuthNone
+	cfg.PoolSize = 1
+	cfg.PoolIdleTimeout = 50 * time.Millisecond
+	st := newTestState(t, cfg)
+
+	deliverN(t, st, 1)
+	time.Sleep(100 * time.Millisecond)
+	deliverN(t, st, 1)
+	if n := f.connCount(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+
+	// The evicted connection was quit, only the new one stays open. The
+	// server closes it shortly after replying to QUIT.
+	open := 0
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		f.mu.Lock()
+		open = len(f.open)
+		f.mu.Unlock()
+		if open == 1 {
+			break
+		}
+	}
+	if open != 1 {
+		t.Errorf("%d open connections, want 1", open)
+	}
+}
+
+func TestPoolRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *fakeSMTP
+	}{
+		{"421", &fakeSMTP{DropMail: "421"}},
+		{"eof", &fakeSMTP{DropMail: "eof"}},
+		// The server limits the messages per connection, but
+		// PoolMaxMessages is not set.
+		{"max_messages", &fakeSMTP{MaxMessages: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := test.server.start(t)
+			cfg := f.config(t)
+			cfg.AuthMechanism = AuthNone
+			cfg.PoolSize = 1
+			cfg.PoolIdleTimeout = time.Hour
+
+			deliverN(t, newTestState(t, cfg), 2)
+			sent := f.sent()
+			if len(sent) != 2 {
+				t.Fatalf("sent %d messages, want 2", len(sent))
+			}
+			if sent[0].Conn != 1 || sent[1].Conn != 2 {
+				t.Errorf("sent on connections %d and %d, want 1 and 2", sent[0].Conn, sent[1].Conn)
+			}
+		})
+	}
+}
+
+func TestPoolNoRetryOnNewConnection(t *testing.T) {
+	f := (&fakeSMTP{RefuseMail: true}).start(t)
+	cfg := f.config(t)
+	cfg.AuthMechanism = AuthNone
+	cfg.PoolSize = 1
+
+	st := newTestState(t, cfg)
+	err := st.pool.deliver(context.Background(), "noreply@example.com", []string{"steve@example.com"}, testMsg)
+	if err == nil {
+		t.Fatal("deliver succeeded")
+	}
+	if n := f.connCount(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func benchmarkDeliver(b *testing.B, poolSize int) {
+	f := (&fakeSMTP{STARTTLS: true, Auth: "PLAIN"}).start(b)
+	cfg := f.config(b)
+	cfg.PoolSize = poolSize
+	cfg.PoolIdleTimeout = time.Hour
+	st := newTestState(b, cfg)
+
+	b.ResetTimer()
+	deliverN(b, st, b.N)
+}
+
+func BenchmarkDeliverPooled(b *testing.B) {
+	benchmarkDeliver(b, 1)
+}
+
+func BenchmarkDeliverUnpooled(b *testing.B) {
+	benchmarkDeliver(b, 0)
+}
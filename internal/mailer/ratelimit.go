@@ -0,0 +1,221 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Scopes of the rate limits.
+const (
+	RateLimitGlobal  = "global"
+	RateLimitDomain  = "domain"
+	RateLimitAddress = "address"
+)
+
+// RateLimit allows Limit emails per Interval in bursts of up to Burst
+// emails, which defaults to Limit. A zero Limit disables it.
+type RateLimit struct {
+	Limit    int
+	Interval time.Duration
+	Burst    int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Limit > 0 && l.Interval > 0
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst <= 0 {
+		return l.Limit
+	}
+	return l.Burst
+}
+
+func (l RateLimit) newLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(l.Limit)/l.Interval.Seconds()), l.burst())
+}
+
+// refillDuration is the time after which an unused limiter is full again.
+func (l RateLimit) refillDuration() time.Duration {
+	return time.Duration(float64(l.Interval) * float64(l.burst()) / float64(l.Limit))
+}
+
+// RateLimitConfig limits the outgoing emails globally, per recipient
+// domain and per recipient address. Sends exceeding a limit wait for up
+// to MaxWait and fail with a RateLimitError if they would wait longer.
+type RateLimitConfig struct {
+	Global  RateLimit
+	Domain  RateLimit
+	Address RateLimit
+	MaxWait time.Duration
+}
+
+func (cfg RateLimitConfig) enabled() bool {
+	return cfg.Global.enabled() || cfg.Domain.enabled() || cfg.Address.enabled()
+}
+
+var ErrRateLimited = errors.New("email rate limit exceeded")
+
+// RateLimitError is returned for emails not sent because of a rate
+// limit. It matches ErrRateLimited.
+type RateLimitError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("%s %s, retry after %s", err.Scope, ErrRateLimited, err.RetryAfter.Round(time.Second))
+}
+
+func (err *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// limiter enforces a RateLimitConfig.
+type limiter struct {
+	cfg    RateLimitConfig
+	global *rate.Limiter
+
+	mu        sync.Mutex
+	domains   *keyedLimiters
+	addresses *keyedLimiters
+}
+
+func newLimiter(cfg RateLimitConfig) *limiter {
+	l := &limiter{
+		cfg:       cfg,
+		domains:   newKeyedLimiters(cfg.Domain),
+		addresses: newKeyedLimiters(cfg.Address),
+	}
+	if cfg.Global.enabled() {
+		l.global = cfg.Global.newLimiter()
+	}
+	return l
+}
+
+// keyedLimiters holds a limiter per key. Limiters that are full again
+// are pruned, as they behave like new ones.
+type keyedLimiters struct {
+	limit     RateLimit
+	limiters  map[string]*keyedLimiter
+	lastPrune time.Time
+}
+
+type keyedLimiter struct {
+	*rate.Limiter
+	lastUsed time.Time
+}
+
+func newKeyedLimiters(limit RateLimit) *keyedLimiters {
+	if !limit.enabled() {
+		return nil
+	}
+	return &keyedLimiters{limit: limit, limiters: map[string]*keyedLimiter{}}
+}
+
+func (k *keyedLimiters) get(key string, now time.Time) *rate.Limiter {
+	if now.Sub(k.lastPrune) > time.Minute {
+		refill := k.limit.refillDuration()
+		for key, lim := range k.limiters {
+			if now.Sub(lim.lastUsed) > refill {
+				delete(k.limiters, key)
+			}
+		}
+		k.lastPrune = now
+	}
+
+	lim, ok := k.limiters[key]
+	if !ok {
+		lim = &keyedLimiter{Limiter: k.limit.newLimiter()}
+		k.limiters[key] = lim
+	}
+	lim.lastUsed = now
+	return lim.Limiter
+}
+
+// reservation holds a token of every limit that applies to an email.
+type reservation struct {
+	now          time.Time
+	reservations []*rate.Reservation
+	// delay is the longest wait for a token and scope its limit.
+	delay time.Duration
+	scope string
+}
+
+func (r *reservation) cancel() {
+	for _, res := range r.reservations {
+		res.CancelAt(r.now)
+	}
+}
+
+// reserve takes a token of every limit that applies to the recipients.
+func (l *limiter) reserve(recipients []string) *reservation {
+	r := &reservation{now: time.Now()}
+	add := func(scope string, lim *rate.Limiter) {
+		res := lim.ReserveN(r.now, 1)
+		r.reservations = append(r.reservations, res)
+		if d := res.DelayFrom(r.now); d > r.delay {
+			r.delay, r.scope = d, scope
+		}
+	}
+
+	if l.global != nil {
+		add(RateLimitGlobal, l.global)
+	}
+	l.mu.Lock()
+	for _, rcpt := range recipients {
+		rcpt = strings.ToLower(rcpt)
+		if l.domains != nil {
+			add(RateLimitDomain, l.domains.get(domainOf(rcpt), r.now))
+		}
+		if l.addresses != nil {
+			add(RateLimitAddress, l.addresses.get(rcpt, r.now))
+		}
+	}
+	l.mu.Unlock()
+	return r
+}
+
+// check reports a RateLimitError if an email to the recipients would
+// fail now, without taking any tokens.
+func (l *limiter) check(recipients []string) error {
+	r := l.reserve(recipients)
+	r.cancel()
+	if r.delay > l.cfg.MaxWait {
+		metrics.EmailThrottled(r.scope, false)
+		return &RateLimitError{Scope: r.scope, RetryAfter: r.delay}
+	}
+	return nil
+}
+
+// wait takes a token of every limit that applies to the recipients and
+// waits until all are available.
+func (l *limiter) wait(ctx context.Context, recipients []string) error {
+	r := l.reserve(recipients)
+	if r.delay == 0 {
+		return nil
+	}
+	if r.delay > l.cfg.MaxWait {
+		r.cancel()
+		metrics.EmailThrottled(r.scope, false)
+		return &RateLimitError{Scope: r.scope, RetryAfter: r.delay}
+	}
+
+	metrics.EmailThrottled(r.scope, true)
+	timer := time.NewTimer(r.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
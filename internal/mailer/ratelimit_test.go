@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterCheck(t *testing.T) {
+	l := newLimiter(RateLimitConfig{
+		Address: RateLimit{Limit: 1, Interval: time.Hour},
+	})
+	ctx := context.Background()
+
+	// Checking does not take the only token.
+	for i := 0; i < 3; i++ {
+		if err := l.check([]string{"steve@example.com"}); err != nil {
+			t.Fatalf("check %d: %v", i+1, err)
+		}
+	}
+	if err := l.wait(ctx, []string{"steve@example.com"}); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	var rateLimitErr *RateLimitError
+	if err := l.check([]string{"Steve@example.com"}); !errors.As(err, &rateLimitErr) || rateLimitErr.Scope != RateLimitAddress {
+		t.Errorf("check after sending = %v, want address RateLimitError", err)
+	}
+	if err := l.check([]string{"alex@example.com"}); err != nil {
+		t.Errorf("check of other address: %v", err)
+	}
+}
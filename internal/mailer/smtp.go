@@ -0,0 +1,275 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+// Security modes of the SMTP connection.
+const (
+	// SecurityNone never uses TLS.
+	SecurityNone = "none"
+	// SecuritySTARTTLS upgrades the connection if the server offers it.
+	SecuritySTARTTLS = "starttls"
+	// SecuritySTARTTLSRequired fails if the server does not offer STARTTLS.
+	SecuritySTARTTLSRequired = "starttls-required"
+	// SecurityImplicitTLS speaks TLS from the start, usually on port 465.
+	SecurityImplicitTLS = "implicit-tls"
+)
+
+// SMTP authentication mechanisms.
+const (
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+)
+
+var (
+	ErrNoSTARTTLS   = errors.New("SMTP server does not support STARTTLS")
+	ErrNoAuth       = errors.New("SMTP server does not support AUTH")
+	ErrInsecureAuth = errors.New("refusing to send SMTP credentials without TLS, set security to none to allow it")
+)
+
+// newTLSConfig returns the TLS config for connections to the SMTP server.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.Host,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg.RootCAs = x509.NewCertPool()
+	if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s contains no PEM encoded certificate", cfg.CAFile)
+	}
+	return tlsCfg, nil
+}
+
+// smtpConn is an SMTP session that is ready to send mail.
+type smtpConn struct {
+	*smtp.Client
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// extend moves the deadline of the connection timeout ahead, but not
+// past the deadline of ctx.
+func (c *smtpConn) extend(ctx context.Context) error {
+	return c.conn.SetDeadline(deadline(ctx, c.timeout))
+}
+
+// deadline returns the time timeout from now, or the deadline of ctx if
+// it is earlier. It is zero without timeout and deadline.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var d time.Time
+	if timeout > 0 {
+		d = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (d.IsZero() || ctxDeadline.Before(d)) {
+		d = ctxDeadline
+	}
+	return d
+}
+
+// send sends msg in the session.
+func (c *smtpConn) send(ctx context.Context, from string, to []string, msg []byte) error {
+	if err := c.extend(ctx); err != nil {
+		return err
+	}
+
+	if err := c.Mail(from); err != nil {
+		return mailError{err}
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// mailError is returned if the server did not accept the sender, so
+// that no part of the message has been sent.
+type mailError struct {
+	err error
+}
+
+func (err mailError) Error() string {
+	return err.err.Error()
+}
+
+func (err mailError) Unwrap() error {
+	return err.err
+}
+
+// dial connects to the SMTP server, secures the connection according to
+// the security mode and authenticates.
+func dial(ctx context.Context, cfg Config, tlsCfg *tls.Config) (*smtpConn, error) {
+	dialer := net.Dialer{Timeout: cfg.ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.SMTPHost)
+	if err != nil {
+		return nil, err
+	}
+
+	secure := false
+	if cfg.Security == SecurityImplicitTLS {
+		conn = tls.Client(conn, tlsCfg)
+		secure = true
+	}
+
+	// The connect timeout also covers the TLS handshake and greeting.
+	if err := conn.SetDeadline(deadline(ctx, cfg.ConnectTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &smtpConn{conn: conn, timeout: cfg.Timeout}
+	c.Client, err = smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.extend(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if err := c.upgrade(cfg, tlsCfg, &secure); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.auth(cfg, secure); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// upgrade uses STARTTLS if the security mode asks for it.
+func (c *smtpConn) upgrade(cfg Config, tlsCfg *tls.Config, secure *bool) error {
+	if *secure || cfg.Security == SecurityNone {
+		return nil
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		if cfg.Security == SecuritySTARTTLSRequired {
+			return ErrNoSTARTTLS
+		}
+		return nil
+	}
+
+	if err := c.StartTLS(tlsCfg); err != nil {
+		return err
+	}
+	*secure = true
+	return nil
+}
+
+func (c *smtpConn) auth(cfg Config, secure bool) error {
+	auth := smtpAuth(cfg)
+	if auth == nil {
+		return nil
+	}
+
+	// CRAM-MD5 does not reveal the password, the other mechanisms
+	// are only used without TLS if explicitly configured.
+	if !secure && cfg.Security != SecurityNone && cfg.AuthMechanism != AuthCRAMMD5 {
+		return ErrInsecureAuth
+	}
+	if ok, _ := c.Extension("AUTH"); !ok {
+		return ErrNoAuth
+	}
+	if err := c.Auth(auth); err != nil {
+		return fmt.Errorf("authenticating as %s: %w", logging.Secret(cfg.Username), err)
+	}
+	return nil
+}
+
+// smtpAuth returns the configured mechanism or nil for none. It
+// defaults to PLAIN if a username is set.
+func smtpAuth(cfg Config) smtp.Auth {
+	mechanism := cfg.AuthMechanism
+	if mechanism == "" {
+		mechanism = AuthPlain
+		if cfg.Username == "" {
+			mechanism = AuthNone
+		}
+	}
+
+	switch mechanism {
+	case AuthPlain:
+		return plainAuth{identity: cfg.Identity, username: cfg.Username, password: cfg.Password}
+	case AuthLogin:
+		return loginAuth{username: cfg.Username, password: cfg.Password}
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.Password)
+	default:
+		return nil
+	}
+}
+
+// plainAuth is smtp.PlainAuth without its TLS check, which dial does
+// according to the security mode.
+type plainAuth struct {
+	identity, username, password string
+}
+
+func (a plainAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "PLAIN", []byte(a.identity + "\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a plainAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("unexpected server challenge")
+	}
+	return nil, nil
+}
+
+// loginAuth implements the LOGIN mechanism, which is not standardized
+// but still required by some servers.
+type loginAuth struct {
+	username, password string
+}
+
+func (a loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(a.username), nil
+	case "Password:", "Password\x00":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
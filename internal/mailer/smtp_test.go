@@ -0,0 +1,256 @@
+package mailer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// sendFake dials the fake server with cfg and sends a message.
+func sendFake(t *testing.T, cfg Config) error {
+	t.Helper()
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+
+	ctx := context.Background()
+	c, err := dial(ctx, cfg, tlsCfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.send(ctx, cfg.Email, []string{"steve@example.com"}, []byte("Subject: Test\r\n\r\nHello\r\n")); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func TestDialSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   *fakeSMTP
+		security string
+		wantTLS  bool
+		wantErr  error
+	}{
+		{"none", &fakeSMTP{STARTTLS: true}, SecurityNone, false, nil},
+		{"starttls", &fakeSMTP{STARTTLS: true}, SecuritySTARTTLS, true, nil},
+		{"starttls_not_offered", &fakeSMTP{}, SecuritySTARTTLS, false, nil},
+		{"starttls_required", &fakeSMTP{STARTTLS: true}, SecuritySTARTTLSRequired, true, nil},
+		{"starttls_required_not_offered", &fakeSMTP{}, SecuritySTARTTLSRequired, false, ErrNoSTARTTLS},
+		{"implicit_tls", &fakeSMTP{ImplicitTLS: true}, SecurityImplicitTLS, true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := test.server.start(t)
+			cfg := f.config(t)
+			cfg.Security = test.security
+			cfg.AuthMechanism = AuthNone
+
+			err := sendFake(t, cfg)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("send error %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				if sent := f.sent(); len(sent) != 0 {
+					t.Errorf("sent %d messages, want none", len(sent))
+				}
+				return
+			}
+
+			sent := f.sent()
+			if len(sent) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(sent))
+			}
+			if sent[0].TLS != test.wantTLS {
+				t.Errorf("TLS = %t, want %t", sent[0].TLS, test.wantTLS)
+			}
+			if sent[0].From != "noreply@example.com" || len(sent[0].To) != 1 || sent[0].To[0] != "steve@example.com" {
+				t.Errorf("envelope %s -> %v", sent[0].From, sent[0].To)
+			}
+		})
+	}
+}
+
+func TestDialAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    *fakeSMTP
+		security  string
+		mechanism string
+		password  string
+		wantAuth  string
+		wantErr   error
+	}{
+		{"plain", &fakeSMTP{STARTTLS: true, Auth: "PLAIN LOGIN CRAM-MD5"}, SecuritySTARTTLS, AuthPlain, fakePassword, "PLAIN", nil},
+		{"login", &fakeSMTP{STARTTLS: true, Auth: "PLAIN LOGIN CRAM-MD5"}, SecuritySTARTTLS, AuthLogin, fakePassword, "LOGIN", nil},
+		{"cram_md5", &fakeSMTP{STARTTLS: true, Auth: "PLAIN LOGIN CRAM-MD5"}, SecuritySTARTTLS, AuthCRAMMD5, fakePassword, "CRAM-MD5", nil},
+		{"implicit_tls", &fakeSMTP{ImplicitTLS: true, Auth: "PLAIN"}, SecurityImplicitTLS, AuthPlain, fakePassword, "PLAIN", nil},
+		// CRAM-MD5 does not reveal the password and is allowed without TLS.
+		{"cram_md5_plaintext", &fakeSMTP{Auth: "CRAM-MD5"}, SecuritySTARTTLS, AuthCRAMMD5, fakePassword, "CRAM-MD5", nil},
+		// Security none explicitly allows credentials without TLS.
+		{"plain_security_none", &fakeSMTP{Auth: "PLAIN"}, SecurityNone, AuthPlain, fakePassword, "PLAIN", nil},
+		{"plain_insecure", &fakeSMTP{Auth: "PLAIN"}, SecuritySTARTTLS, AuthPlain, fakePassword, "", ErrInsecureAuth},
+		{"login_insecure", &fakeSMTP{Auth: "LOGIN"}, SecuritySTARTTLS, AuthLogin, fakePassword, "", ErrInsecureAuth},
+		{"not_offered", &fakeSMTP{STARTTLS: true}, SecuritySTARTTLS, AuthPlain, fakePassword, "", ErrNoAuth},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := test.server.start(t)
+			cfg := f.config(t)
+			cfg.Security = test.security
+			cfg.AuthMechanism = test.mechanism
+			cfg.Password = test.password
+
+			err := sendFake(t, cfg)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("send error %v, want %v", err, test.wantErr)
+			}
+
+			auths := f.authenticated()
+			if test.wantAuth == "" {
+				// The credentials never reach the server.
+				if len(auths) != 0 {
+					t.Errorf("server saw %d AUTH commands, want none", len(auths))
+				}
+				return
+			}
+			if len(auths) != 1 {
+				t.Fatalf("server saw %d AUTH commands, want 1", len(auths))
+			}
+			if auths[0].Mechanism != test.wantAuth || auths[0].Username != fakeUsername || !auths[0].Valid {
+				t.Errorf("AUTH %+v, want valid %s for %s", auths[0], test.wantAuth, fakeUsername)
+			}
+			if len(f.sent()) != 1 {
+				t.Errorf("sent %d messages, want 1", len(f.sent()))
+			}
+		})
+	}
+}
+
+func TestDialAuthInvalid(t *testing.T) {
+	f := (&fakeSMTP{STARTTLS: true, Auth: "PLAIN LOGIN CRAM-MD5"}).start(t)
+	for _, mechanism := range []string{AuthPlain, AuthLogin, AuthCRAMMD5} {
+		cfg := f.config(t)
+		cfg.AuthMechanism = mechanism
+		cfg.Password = "wrong"
+		if err := sendFake(t, cfg); err == nil {
+			t.Errorf("%s with wrong password succeeded", mechanism)
+		}
+	}
+	if len(f.sent()) != 0 {
+		t.Errorf("sent %d messages without valid credentials", len(f.sent()))
+	}
+}
+
+func TestDialTrust(t *testing.T) {
+	for _, security := range []string{SecuritySTARTTLS, SecurityImplicitTLS} {
+		t.Run(security, func(t *testing.T) {
+			f := (&fakeSMTP{STARTTLS: true, ImplicitTLS: security == SecurityImplicitTLS}).start(t)
+
+			cfg := f.config(t)
+			cfg.Security = security
+			cfg.AuthMechanism = AuthNone
+			if err := sendFake(t, cfg); err != nil {
+				t.Errorf("with ca_file: %v", err)
+			}
+
+			// The certificate is not trusted by the system roots.
+			cfg.CAFile = ""
+			var unknownAuthority x509.UnknownAuthorityError
+			if err := sendFake(t, cfg); !errors.As(err, &unknownAuthority) {
+				t.Errorf("without ca_file: %v, want unknown authority", err)
+			}
+
+			cfg.InsecureSkipVerify = true
+			if err := sendFake(t, cfg); err != nil {
+				t.Errorf("with insecure_skip_verify: %v", err)
+			}
+
+			// The certificate is not valid for another host.
+			cfg.InsecureSkipVerify = false
+			cfg.CAFile = f.config(t).CAFile
+			cfg.Host = "mail.example.org"
+			var invalidHost x509.HostnameError
+			if err := sendFake(t, cfg); !errors.As(err, &invalidHost) {
+				t.Errorf("with other host: %v, want hostname error", err)
+			}
+		})
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	t.Run("connect", func(t *testing.T) {
+		f := (&fakeSMTP{GreetingDelay: time.Second}).start(t)
+		cfg := f.config(t)
+		cfg.ConnectTimeout = 100 * time.Millisecond
+
+		start := time.Now()
+		err := sendFake(t, cfg)
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("send error %v, want timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+			t.Errorf("timed out after %s", elapsed)
+		}
+	})
+
+	t.Run("implicit_tls_connect", func(t *testing.T) {
+		f := (&fakeSMTP{ImplicitTLS: true, GreetingDelay: time.Second}).start(t)
+		cfg := f.config(t)
+		cfg.Security = SecurityImplicitTLS
+		cfg.ConnectTimeout = 100 * time.Millisecond
+
+		var netErr net.Error
+		if err := sendFake(t, cfg); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("send error %v, want timeout", err)
+		}
+	})
+
+	t.Run("exchange", func(t *testing.T) {
+		f := (&fakeSMTP{MailDelay: time.Second}).start(t)
+		cfg := f.config(t)
+		cfg.AuthMechanism = AuthNone
+		cfg.Timeout = 100 * time.Millisecond
+
+		err := sendFake(t, cfg)
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("send error %v, want timeout", err)
+		}
+		if len(f.sent()) != 0 {
+			t.Error("message sent despite the timeout")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		f := (&fakeSMTP{MailDelay: time.Second}).start(t)
+		cfg := f.config(t)
+		cfg.AuthMechanism = AuthNone
+
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		c, err := dial(ctx, cfg, tlsCfg)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer c.Close()
+
+		// The deadline of ctx is earlier than the exchange timeout.
+		var netErr net.Error
+		if err := c.send(ctx, cfg.Email, []string{"steve@example.com"}, []byte("\r\n")); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("send error %v, want timeout", err)
+		}
+	})
+}
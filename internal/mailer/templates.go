@@ -0,0 +1,349 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// FallbackLocale is used if no preferred locale has a template.
+const FallbackLocale = "en"
+
+const (
+	TemplateVerification   = "verification"
+	TemplateVerified       = "verified"
+	TemplateExpiryReminder = "expiry_reminder"
+	TemplateRevoked        = "revoked"
+)
+
+// sampleData holds example data for every known template. It is used to
+// validate templates and to preview them.
+var sampleData = map[string]interface{}{
+	TemplateVerification: VerificationEmailData{
+		Code:     "A1B2C3",
+		Username: "Steve",
+		UUID:     "8667ba71-b85a-4004-af54-457a9734eed7",
+		Time:     "2021-10-01T12:00:00+02:00",
+	},
+	TemplateVerified: VerifiedEmailData{
+		Username: "Steve",
+		UUID:     "8667ba71-b85a-4004-af54-457a9734eed7",
+		Email:    "steve@stud.hs-heilbronn.de",
+		Time:     "2021-10-01T12:00:00+02:00",
+	},
+	TemplateExpiryReminder: ExpiryReminderEmailData{
+		Username:  "Steve",
+		UUID:      "8667ba71-b85a-4004-af54-457a9734eed7",
+		Email:     "steve@stud.hs-heilbronn.de",
+		ExpiresAt: "2022-04-01T12:00:00+02:00",
+		Days:      14,
+	},
+	TemplateRevoked: RevokedEmailData{
+		Username: "Steve",
+		UUID:     "8667ba71-b85a-4004-af54-457a9734eed7",
+		Email:    "steve@stud.hs-heilbronn.de",
+		Reason:   "Account shared with another player",
+		Time:     "2021-10-01T12:00:00+02:00",
+	},
+}
+
+// TemplateNames returns the names of all known templates.
+func TemplateNames() []string {
+	names := make([]string, 0, len(sampleData))
+	for name := range sampleData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrTemplateNotFound is returned if a template exists in no locale.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Template is an email in one locale. Text or HTML may be nil.
+type Template struct {
+	Subject *texttemplate.Template
+	Text    *texttemplate.Template
+	HTML    *template.Template
+}
+
+// Rendered is the result of rendering a template.
+type Rendered struct {
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	Text    string `json:"text,omitempty"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Registry holds the email templates by locale and name. The templates
+// of a locale are the files <locale>/<name>.subject, <name>.txt and
+// <name>.html; the subject and at least one of the bodies are required.
+type Registry struct {
+	// templates maps locale to name to template.
+	templates map[string]map[string]Template
+}
+
+// templateExts are the file extensions of the parts of a template.
+var templateExts = []string{".subject", ".txt", ".html"}
+
+// source is a template file and where it was read from.
+type source struct {
+	path    string
+	content string
+}
+
+// NewRegistry parses the templates in the layers. Files in later layers
+// override the same file of earlier ones, so a layer may replace single
+// parts of a template like only its subject.
+func NewRegistry(layers ...fs.FS) (*Registry, error) {
+	// sources maps locale to name to extension to file.
+	sources := map[string]map[string]map[string]source{}
+	for _, fsys := range layers {
+		if err := readSources(fsys, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	reg := &Registry{templates: map[string]map[string]Template{}}
+	for locale, names := range sources {
+		reg.templates[locale] = map[string]Template{}
+		for name, files := range names {
+			tmpl, err := parseTemplate(name, files)
+			if err != nil {
+				return nil, fmt.Errorf("template %s/%s: %w", locale, name, err)
+			}
+			if err := validateTemplate(name, tmpl); err != nil {
+				return nil, fmt.Errorf("template %s/%s: %w", locale, name, err)
+			}
+			reg.templates[locale][name] = tmpl
+		}
+	}
+
+	return reg, nil
+}
+
+// DefaultRegistry returns the built-in templates.
+func DefaultRegistry() (*Registry, error) {
+	return LoadRegistry("")
+}
+
+// LoadRegistry returns the built-in templates overridden by the files
+// in dir. An empty dir means no overrides.
+func LoadRegistry(dir string) (*Registry, error) {
+	embedded, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return NewRegistry(embedded)
+	}
+
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is no directory", dir)
+	}
+	reg, err := NewRegistry(embedded, os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("templates in %s: %w", dir, err)
+	}
+	return reg, nil
+}
+
+func readSources(fsys fs.FS, sources map[string]map[string]map[string]source) error {
+	locales, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		if _, err := language.Parse(locale.Name()); err != nil {
+			return fmt.Errorf("template directory %s is no locale like de or en-US", locale.Name())
+		}
+		key := strings.ToLower(locale.Name())
+
+		files, err := fs.ReadDir(fsys, locale.Name())
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			ext := path.Ext(file.Name())
+			if file.IsDir() || !isTemplateExt(ext) {
+				continue
+			}
+			filePath := path.Join(locale.Name(), file.Name())
+			name := strings.TrimSuffix(file.Name(), ext)
+			if _, ok := sampleData[name]; !ok {
+				return fmt.Errorf("%s: unknown template %s, must be one of %s",
+					filePath, name, strings.Join(TemplateNames(), ", "))
+			}
+
+			content, err := fs.ReadFile(fsys, filePath)
+			if err != nil {
+				return err
+			}
+
+			if sources[key] == nil {
+				sources[key] = map[string]map[string]source{}
+			}
+			if sources[key][name] == nil {
+				sources[key][name] = map[string]source{}
+			}
+			sources[key][name][ext] = source{path: filePath, content: string(content)}
+		}
+	}
+	return nil
+}
+
+func isTemplateExt(ext string) bool {
+	for _, e := range templateExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTemplate(name string, files map[string]source) (Template, error) {
+	var tmpl Template
+	var err error
+
+	subject, ok := files[".subject"]
+	if !ok {
+		return Template{}, errors.New("missing .subject file")
+	}
+	tmpl.Subject, err = texttemplate.New(subject.path).Parse(strings.TrimSpace(subject.content))
+	if err != nil {
+		return Template{}, err
+	}
+
+	if text, ok := files[".txt"]; ok {
+		if tmpl.Text, err = texttemplate.New(text.path).Parse(text.content); err != nil {
+			return Template{}, err
+		}
+	}
+
+	if html, ok := files[".html"]; ok {
+		if tmpl.HTML, err = template.New(html.path).Parse(html.content); err != nil {
+			return Template{}, err
+		}
+	}
+
+	if tmpl.Text == nil && tmpl.HTML == nil {
+		return Template{}, errors.New("neither a .txt nor an .html body")
+	}
+	return tmpl, nil
+}
+
+// validateTemplate renders tmpl with sample data, which catches
+// references to fields the data of the template does not have.
+func validateTemplate(name string, tmpl Template) error {
+	_, err := tmpl.render(sampleData[name])
+	return err
+}
+
+// Locales returns the locales with templates.
+func (reg *Registry) Locales() []string {
+	locales := make([]string, 0, len(reg.templates))
+	for locale := range reg.templates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// candidates returns the locales to try for the preferences in order.
+func candidates(preferences []string) []string {
+	var locales []string
+	for _, preference := range preferences {
+		tags, _, _ := language.ParseAcceptLanguage(preference)
+		for _, tag := range tags {
+			locales = append(locales, strings.ToLower(tag.String()))
+			if base, conf := tag.Base(); conf != language.No {
+				locales = append(locales, base.String())
+			}
+		}
+	}
+	return append(locales, FallbackLocale)
+}
+
+// Lookup returns the template name in the first of the preferred
+// locales with a translation, or else in FallbackLocale. Preferences
+// are locales like de-AT or Accept-Language headers; de-AT falls back
+// to de.
+func (reg *Registry) Lookup(name string, preferences ...string) (Template, string, error) {
+	for _, locale := range candidates(preferences) {
+		if tmpl, ok := reg.templates[locale][name]; ok {
+			return tmpl, locale, nil
+		}
+	}
+	return Template{}, "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// Render renders the template name in the best locale for the
+// preferences, see Lookup.
+func (reg *Registry) Render(name string, data interface{}, preferences ...string) (Rendered, error) {
+	tmpl, locale, err := reg.Lookup(name, preferences...)
+	if err != nil {
+		return Rendered{}, err
+	}
+
+	rendered, err := tmpl.render(data)
+	if err != nil {
+		return Rendered{}, err
+	}
+	rendered.Locale = locale
+	return rendered, nil
+}
+
+// Preview renders the template name with sample data.
+func (reg *Registry) Preview(name string, preferences ...string) (Rendered, error) {
+	data, ok := sampleData[name]
+	if !ok {
+		return Rendered{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return reg.Render(name, data, preferences...)
+}
+
+func (tmpl Template) render(data interface{}) (Rendered, error) {
+	var rendered Rendered
+	var buf bytes.Buffer
+	if err := tmpl.Subject.Execute(&buf, data); err != nil {
+		return Rendered{}, err
+	}
+	rendered.Subject = buf.String()
+
+	if tmpl.Text != nil {
+		buf.Reset()
+		if err := tmpl.Text.Execute(&buf, data); err != nil {
+			return Rendered{}, err
+		}
+		rendered.Text = buf.String()
+	}
+
+	if tmpl.HTML != nil {
+		buf.Reset()
+		if err := tmpl.HTML.Execute(&buf, data); err != nil {
+			return Rendered{}, err
+		}
+		rendered.HTML = buf.String()
+	}
+
+	return rendered, nil
+}
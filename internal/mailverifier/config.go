@@ -2,8 +2,12 @@ package mailverifier
 
 import (
 	_ "embed"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,17 +16,47 @@ import (
 var defaultConfig []byte
 
 type Config struct {
-	EmailRegex             string         `yaml:"email_regex"`
-	VerificationCodeLength int            `yaml:"verification_code_length"`
-	EmailValidityDuration  string         `yaml:"email_validity_duration"`
-	MaxEmailTries          int            `yaml:"max_email_tries"`
-	API                    APIConfig      `yaml:"api"`
-	Email                  EmailConfig    `yaml:"email"`
-	Database               DatabaseConfig `yaml:"database"`
+	EmailRegex             string              `yaml:"email_regex"`
+	VerificationCodeLength int                 `yaml:"verification_code_length"`
+	EmailValidityDuration  string              `yaml:"email_validity_duration"`
+	ExpireByAge            bool                `yaml:"expire_by_age"`
+	ExpiryCheckInterval    string              `yaml:"expiry_check_interval"`
+	MaxEmailTries          int                 `yaml:"max_email_tries"`
+	API                    APIConfig           `yaml:"api"`
+	Email                  EmailConfig         `yaml:"email"`
+	Database               DatabaseConfig      `yaml:"database"`
+	Metrics                MetricsConfig       `yaml:"metrics"`
+	Log                    LogConfig           `yaml:"log"`
+	Tracing                TracingConfig       `yaml:"tracing"`
+	Reload                 ReloadConfig        `yaml:"reload"`
+	Auth                   AuthConfig          `yaml:"auth"`
+	Webhooks               WebhooksConfig      `yaml:"webhooks"`
+	Events                 EventsConfig        `yaml:"events"`
+	GRPC                   GRPCConfig          `yaml:"grpc"`
+	Bounces                BouncesConfig       `yaml:"bounces"`
+	Notifications          NotificationsConfig `yaml:"notifications"`
+	Audit                  AuditConfig         `yaml:"audit"`
 }
 
 type APIConfig struct {
-	Bind string `yaml:"bind"`
+	Bind              string    `yaml:"bind"`
+	ReadTimeout       string    `yaml:"read_timeout"`
+	ReadHeaderTimeout string    `yaml:"read_header_timeout"`
+	WriteTimeout      string    `yaml:"write_timeout"`
+	IdleTimeout       string    `yaml:"idle_timeout"`
+	ShutdownTimeout   string    `yaml:"shutdown_timeout"`
+	MaxHeaderBytes    int       `yaml:"max_header_bytes"`
+	MaxBodyBytes      int64     `yaml:"max_body_bytes"`
+	TLS               TLSConfig `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	SelfSigned   bool   `yaml:"self_signed"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	ClientAuth   string `yaml:"client_auth"`
 }
 
 type EmailConfig struct {
@@ -32,14 +66,168 @@ type EmailConfig struct {
 	Alias    string `yaml:"alias"`
 	Identity string `yaml:"identity"`
 	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
+	// DefaultLocale is used if the request does not ask for a locale.
+	DefaultLocale string `yaml:"default_locale"`
+	// TemplateDir overrides the built-in email templates with the files
+	// <locale>/<name>.subject, .txt and .html in it.
+	TemplateDir string     `yaml:"template_dir"`
+	DKIM        DKIMConfig `yaml:"dkim"`
+
+	Security           string `yaml:"security"`
+	AuthMechanism      string `yaml:"auth_mechanism"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	ConnectTimeout     string `yaml:"connect_timeout"`
+	Timeout            string `yaml:"timeout"`
+
+	PoolSize        int    `yaml:"pool_size"`
+	PoolMaxMessages int    `yaml:"pool_max_messages"`
+	PoolIdleTimeout string `yaml:"pool_idle_timeout"`
+
+	RateLimit EmailRateLimitConfig `yaml:"rate_limit"`
+}
+
+type EmailRateLimitConfig struct {
+	MaxWait string          `yaml:"max_wait"`
+	Global  RateLimitConfig `yaml:"global"`
+	Domain  RateLimitConfig `yaml:"domain"`
+	Address RateLimitConfig `yaml:"address"`
+}
+
+// RateLimitConfig allows Limit emails per Interval, 0 disables it.
+type RateLimitConfig struct {
+	Limit    int    `yaml:"limit"`
+	Interval string `yaml:"interval"`
+	Burst    int    `yaml:"burst"`
+}
+
+// DKIMConfig enables DKIM signing of all emails if KeyFile is set.
+type DKIMConfig struct {
+	Domain   string   `yaml:"domain"`
+	Selector string   `yaml:"selector"`
+	KeyFile  string   `yaml:"key_file"`
+	Headers  []string `yaml:"headers"`
 }
 
 type DatabaseConfig struct {
 	Host     string `yaml:"host"`
 	Database string `yaml:"database"`
 	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+type LogConfig struct {
+	Level   string `yaml:"level"`
+	Format  string `yaml:"format"`
+	Privacy string `yaml:"privacy"`
+}
+
+type TracingConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Exporter    string `yaml:"exporter"`
+	Endpoint    string `yaml:"endpoint"`
+	Insecure    bool   `yaml:"insecure"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio defaults to 1 if unset, 0 samples no traces.
+	SampleRatio *float64 `yaml:"sample_ratio"`
+}
+
+// Ratio returns the sample ratio or its default 1.
+func (cfg TracingConfig) Ratio() float64 {
+	if cfg.SampleRatio == nil {
+		return 1
+	}
+	return *cfg.SampleRatio
+}
+
+type AuditConfig struct {
+	// Retention of audit events, 0 keeps them forever.
+	Retention     string `yaml:"retention"`
+	PurgeInterval string `yaml:"purge_interval"`
+}
+
+type ReloadConfig struct {
+	WatchInterval string `yaml:"watch_interval"`
+}
+
+type AuthConfig struct {
+	Required bool           `yaml:"required"`
+	Keys     []APIKeyConfig `yaml:"keys"`
+}
+
+type APIKeyConfig struct {
+	Name    string   `yaml:"name"`
+	Key     string   `yaml:"key" secret:"true"`
+	KeyFile string   `yaml:"key_file"`
+	Scopes  []string `yaml:"scopes"`
+}
+
+// Secret returns the key, reading it from KeyFile if set.
+func (cfg APIKeyConfig) Secret() (string, error) {
+	if cfg.KeyFile == "" {
+		return cfg.Key, nil
+	}
+
+	bb, err := ioutil.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(bb), "\r\n"), nil
+}
+
+type WebhooksConfig struct {
+	Timeout        string                      `yaml:"timeout"`
+	MaxAttempts    int                         `yaml:"max_attempts"`
+	InitialBackoff string                      `yaml:"initial_backoff"`
+	MaxBackoff     string                      `yaml:"max_backoff"`
+	Subscriptions  []WebhookSubscriptionConfig `yaml:"subscriptions"`
+}
+
+type WebhookSubscriptionConfig struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret" secret:"true"`
+	Events []string `yaml:"events"`
+}
+
+type EventsConfig struct {
+	Backend string `yaml:"backend"`
+	// MaxStreamDuration ends event streams after the duration,
+	// 0 keeps them open until the client disconnects.
+	MaxStreamDuration string `yaml:"max_stream_duration"`
+}
+
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Bind    string `yaml:"bind"`
+}
+
+type BouncesConfig struct {
+	// Maildir is polled for bounces if set.
+	Maildir      string `yaml:"maildir"`
+	PollInterval string `yaml:"poll_interval"`
+}
+
+// NotificationsConfig enables emails to players in addition to the
+// verification codes.
+type NotificationsConfig struct {
+	Verified       bool                 `yaml:"verified"`
+	Revoked        bool                 `yaml:"revoked"`
+	ExpiryReminder ExpiryReminderConfig `yaml:"expiry_reminder"`
+}
+
+type ExpiryReminderConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Before is how long before the end of the email validity
+	// duration players are reminded.
+	Before        string `yaml:"before"`
+	CheckInterval string `yaml:"check_interval"`
 }
 
 func CreateConfigIfNotExist(path string) error {
@@ -50,6 +238,20 @@ func CreateConfigIfNotExist(path string) error {
 	return ioutil.WriteFile(path, defaultConfig, 0644)
 }
 
+// WriteDefaultConfig writes the default config to path. An existing
+// file is only replaced if overwrite is set.
+func WriteDefaultConfig(path string, overwrite bool) error {
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return fmt.Errorf("%s already exists", path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return ioutil.WriteFile(path, defaultConfig, 0644)
+}
+
+// LoadConfig reads the config file at path and applies the
+// MAILVERIFIER_* environment variable overrides.
 func LoadConfig(path string) (Config, error) {
 	bb, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -61,5 +263,40 @@ func LoadConfig(path string) (Config, error) {
 		return Config{}, err
 	}
 
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
+
+const maskedSecret = "********"
+
+// Masked returns a copy of the config with all non-empty fields tagged
+// as secret replaced, so it can be printed or logged.
+func (cfg Config) Masked() Config {
+	maskStruct(reflect.ValueOf(&cfg).Elem())
+	return cfg
+}
+
+func maskStruct(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			maskStruct(field)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			masked := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			reflect.Copy(masked, field)
+			for j := 0; j < masked.Len(); j++ {
+				maskStruct(masked.Index(j))
+			}
+			field.Set(masked)
+		case field.Kind() == reflect.String && t.Field(i).Tag.Get("secret") == "true":
+			if field.String() != "" {
+				field.SetString(maskedSecret)
+			}
+		}
+	}
+}
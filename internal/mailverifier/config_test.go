@@ -0,0 +1,36 @@
+package mailverifier
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTracingRatio(t *testing.T) {
+	tests := []struct {
+		yaml string
+		env  map[string]string
+		want float64
+	}{
+		{yaml: "enabled: true", want: 1},
+		{yaml: "sample_ratio: 0", want: 0},
+		{yaml: "sample_ratio: 0.25", want: 0.25},
+		{yaml: "sample_ratio: 0.25", env: map[string]string{"MAILVERIFIER_TRACING_SAMPLE_RATIO": "0"}, want: 0},
+	}
+	for _, test := range tests {
+		var cfg Config
+		if err := yaml.Unmarshal([]byte("tracing: {"+test.yaml+"}"), &cfg); err != nil {
+			t.Fatalf("%q: %v", test.yaml, err)
+		}
+		lookup := func(name string) (string, bool) {
+			value, ok := test.env[name]
+			return value, ok
+		}
+		if err := applyEnv(&cfg, lookup); err != nil {
+			t.Fatalf("%q: applyEnv: %v", test.yaml, err)
+		}
+		if got := cfg.Tracing.Ratio(); got != test.want {
+			t.Errorf("%q %v: ratio = %v, want %v", test.yaml, test.env, got, test.want)
+		}
+	}
+}
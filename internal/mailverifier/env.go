@@ -0,0 +1,178 @@
+package mailverifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	envPrefix     = "MAILVERIFIER"
+	envFileSuffix = "_FILE"
+)
+
+// applyEnv overrides config fields with environment variables. The
+// variable name is derived from the yaml path of the field, e.g.
+// email.password becomes MAILVERIFIER_EMAIL_PASSWORD. If a variable
+// with the suffix _FILE is set instead, the value is read from that
+// file, which allows using Docker secrets. Elements of lists of objects
+// are addressed by index, e.g. MAILVERIFIER_AUTH_KEYS_0_KEY. Indexes past
+// the end of the list append elements, so they have to be consecutive.
+// A variable set to an empty value clears the field.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	_, err := applyEnvStruct(reflect.ValueOf(cfg).Elem(), envPrefix, lookup)
+	return err
+}
+
+// applyEnvStruct reports whether any field of v was set.
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	set := false
+	t := v.Type()
+	tags := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		tags[yamlName(t.Field(i))] = true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := yamlName(t.Field(i))
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			fieldSet, err := applyEnvStruct(field, name, lookup)
+			if err != nil {
+				return false, err
+			}
+			set = set || fieldSet
+			continue
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			fieldSet, err := applyEnvList(field, name, lookup)
+			if err != nil {
+				return false, err
+			}
+			set = set || fieldSet
+			continue
+		}
+
+		// A field like key_file takes precedence over reading key
+		// from a file.
+		value, ok, err := envValue(name, !tags[tag+"_file"], lookup)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// applyEnvList overrides the elements of a list of structs by index and
+// appends elements until an index has no variables.
+func applyEnvList(list reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	set := false
+	for i := 0; ; i++ {
+		name := prefix + "_" + strconv.Itoa(i)
+		if i < list.Len() {
+			elemSet, err := applyEnvStruct(list.Index(i), name, lookup)
+			if err != nil {
+				return false, err
+			}
+			set = set || elemSet
+			continue
+		}
+
+		elem := reflect.New(list.Type().Elem()).Elem()
+		elemSet, err := applyEnvStruct(elem, name, lookup)
+		if err != nil {
+			return false, err
+		}
+		if !elemSet {
+			return set, nil
+		}
+		list.Set(reflect.Append(list, elem))
+		set = true
+	}
+}
+
+func yamlName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+// envValue looks up the variable name, or if allowFile the file named by
+// the variable with the _FILE suffix.
+func envValue(name string, allowFile bool, lookup func(string) (string, bool)) (string, bool, error) {
+	if value, ok := lookup(name); ok {
+		return value, true, nil
+	}
+	if !allowFile {
+		return "", false, nil
+	}
+
+	path, ok := lookup(name + envFileSuffix)
+	if !ok {
+		return "", false, nil
+	}
+
+	bb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s: %w", name, envFileSuffix, err)
+	}
+	return strings.TrimRight(string(bb), "\r\n"), true, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		var ss []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ss = append(ss, s)
+			}
+		}
+		field.Set(reflect.ValueOf(ss))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
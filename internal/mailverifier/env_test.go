@@ -0,0 +1,72 @@
+package mailverifier
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyEnvLists(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("webhook-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"MAILVERIFIER_AUTH_KEYS_0_KEY":                      "overridden-key-0000",
+		"MAILVERIFIER_AUTH_KEYS_1_NAME":                     "bot",
+		"MAILVERIFIER_AUTH_KEYS_1_KEY_FILE":                 "/run/secrets/bot_key",
+		"MAILVERIFIER_AUTH_KEYS_1_SCOPES":                   "admin",
+		"MAILVERIFIER_WEBHOOKS_SUBSCRIPTIONS_0_NAME":        "discord",
+		"MAILVERIFIER_WEBHOOKS_SUBSCRIPTIONS_0_URL":         "https://example.com/hook",
+		"MAILVERIFIER_WEBHOOKS_SUBSCRIPTIONS_0_SECRET_FILE": secretFile,
+		"MAILVERIFIER_WEBHOOKS_SUBSCRIPTIONS_0_EVENTS":      "player.created, verification.completed",
+		// Not consecutive, so it is ignored.
+		"MAILVERIFIER_WEBHOOKS_SUBSCRIPTIONS_2_NAME": "ignored",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	cfg := Config{Auth: AuthConfig{Keys: []APIKeyConfig{{Name: "api", Key: "configured-key-000"}}}}
+	if err := applyEnv(&cfg, lookup); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+
+	wantKeys := []APIKeyConfig{
+		{Name: "api", Key: "overridden-key-0000"},
+		{Name: "bot", KeyFile: "/run/secrets/bot_key", Scopes: []string{"admin"}},
+	}
+	if !reflect.DeepEqual(cfg.Auth.Keys, wantKeys) {
+		t.Errorf("auth.keys = %+v, want %+v", cfg.Auth.Keys, wantKeys)
+	}
+
+	wantSubscriptions := []WebhookSubscriptionConfig{{
+		Name:   "discord",
+		URL:    "https://example.com/hook",
+		Secret: "webhook-secret",
+		Events: []string{"player.created", "verification.completed"},
+	}}
+	if !reflect.DeepEqual(cfg.Webhooks.Subscriptions, wantSubscriptions) {
+		t.Errorf("webhooks.subscriptions = %+v, want %+v", cfg.Webhooks.Subscriptions, wantSubscriptions)
+	}
+}
+
+func TestApplyEnvEmpty(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "MAILVERIFIER_EMAIL_PASSWORD" {
+			return "", true
+		}
+		return "", false
+	}
+
+	cfg := Config{Email: EmailConfig{Username: "admin", Password: "from-file"}}
+	if err := applyEnv(&cfg, lookup); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.Email.Password != "" || cfg.Email.Username != "admin" {
+		t.Errorf("email = %+v, want cleared password and unchanged username", cfg.Email)
+	}
+}
@@ -0,0 +1,211 @@
+package mailverifier
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// restartRequired lists the yaml paths of the config sections and
+// fields that are only read at startup. Changes to them are reported but
+// have no effect until restart.
+var restartRequired = []string{
+	"expiry_check_interval",
+	"api",
+	"database",
+	"metrics",
+	"tracing",
+	"reload",
+	"events",
+	"grpc",
+	"bounces",
+	"notifications.expiry_reminder.check_interval",
+	"audit",
+}
+
+// Reloader holds the current config and replaces it when the file
+// changes or the process receives SIGHUP. A new config is only swapped
+// in if it is valid.
+type Reloader struct {
+	path string
+
+	mu        sync.Mutex
+	cfg       atomic.Value
+	modTime   time.Time
+	callbacks []func(Config) error
+}
+
+func NewReloader(path string, cfg Config) *Reloader {
+	r := &Reloader{path: path}
+	r.cfg.Store(cfg)
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+	return r
+}
+
+// Config returns the current config. Restart-only fields keep the
+// values the process was started with.
+func (r *Reloader) Config() Config {
+	return r.cfg.Load().(Config)
+}
+
+// OnReload registers fn to be called with the new config after every
+// successful reload. If fn fails, it has to keep its current config and
+// the reload is reported as partial.
+func (r *Reloader) OnReload(fn func(Config) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.callbacks = append(r.callbacks, fn)
+}
+
+// ErrPartialReload is returned by Reload if a callback failed to apply
+// the new config.
+var ErrPartialReload = errors.New("config reloaded partially")
+
+// Reload loads and validates the config file and swaps it in.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fi, err := os.Stat(r.path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+
+	cfg, err := LoadConfig(r.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		metrics.ConfigReloaded(false)
+		log.Error().Err(err).Str("path", r.path).Msg("Config reload failed, keeping the current config")
+		return err
+	}
+
+	// Restart-only fields stay at the values in effect, so later reloads
+	// keep reporting them until the restart.
+	old := r.Config()
+	if changed := changedFields(old, cfg, restartRequired); len(changed) > 0 {
+		log.Warn().Strs("fields", changed).Msg("Config changes require a restart to take effect")
+		copyFields(&cfg, old, changed)
+	}
+
+	r.cfg.Store(cfg)
+	failed := 0
+	for _, fn := range r.callbacks {
+		if err := fn(cfg); err != nil {
+			failed++
+			log.Error().Err(err).Msg("Failed applying reloaded config, keeping the current one")
+		}
+	}
+
+	if failed > 0 {
+		metrics.ConfigReloadedPartially()
+		log.Warn().Str("path", r.path).Int("failed", failed).Msg("Reloaded config partially")
+		return ErrPartialReload
+	}
+	metrics.ConfigReloaded(true)
+	log.Info().Str("path", r.path).Msg("Reloaded config")
+	return nil
+}
+
+// Watch reloads the config on SIGHUP and, if interval is positive, when
+// the modification time of the file changes. It blocks until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info().Msg("Received SIGHUP, reloading config")
+			r.Reload()
+		case <-tick:
+			if r.fileChanged() {
+				log.Info().Str("path", r.path).Msg("Config file changed, reloading config")
+				r.Reload()
+			}
+		}
+	}
+}
+
+func (r *Reloader) fileChanged() bool {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !fi.ModTime().Equal(r.modTime)
+}
+
+// changedFields returns the given yaml paths like
+// notifications.expiry_reminder.check_interval that differ between a
+// and b.
+func changedFields(a Config, b Config, paths []string) []string {
+	var changed []string
+	for _, path := range paths {
+		fa, fb := yamlField(reflect.ValueOf(a), path), yamlField(reflect.ValueOf(b), path)
+		if !fa.IsValid() || !fb.IsValid() {
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+// copyFields sets the fields at the given yaml paths of dst to the ones
+// of src.
+func copyFields(dst *Config, src Config, paths []string) {
+	for _, path := range paths {
+		d, s := yamlField(reflect.ValueOf(dst).Elem(), path), yamlField(reflect.ValueOf(src), path)
+		if d.IsValid() && s.IsValid() {
+			d.Set(s)
+		}
+	}
+}
+
+// yamlField returns the field of the struct v at the dotted yaml path,
+// or the zero Value if there is none.
+func yamlField(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		next := reflect.Value{}
+		for i := 0; i < v.NumField(); i++ {
+			if yamlName(v.Type().Field(i)) == name {
+				next = v.Field(i)
+				break
+			}
+		}
+		if !next.IsValid() {
+			return next
+		}
+		v = next
+	}
+	return v
+}
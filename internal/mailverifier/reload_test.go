@@ -0,0 +1,96 @@
+package mailverifier
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChangedFields(t *testing.T) {
+	old := Config{ExpiryCheckInterval: "10m"}
+	old.Notifications.ExpiryReminder.CheckInterval = "1h"
+	old.Notifications.ExpiryReminder.Before = "336h"
+
+	cfg := old
+	cfg.ExpiryCheckInterval = "5m"
+	cfg.Notifications.ExpiryReminder.CheckInterval = "30m"
+	// Reloaded without restart.
+	cfg.Notifications.ExpiryReminder.Before = "168h"
+	cfg.MaxEmailTries = 5
+
+	want := []string{"expiry_check_interval", "notifications.expiry_reminder.check_interval"}
+	if changed := changedFields(old, cfg, restartRequired); !reflect.DeepEqual(changed, want) {
+		t.Errorf("changedFields = %q, want %q", changed, want)
+	}
+
+	if changed := changedFields(old, old, restartRequired); len(changed) != 0 {
+		t.Errorf("changedFields of the same config = %q, want none", changed)
+	}
+	if changed := changedFields(old, cfg, []string{"notifications.unknown"}); len(changed) != 0 {
+		t.Errorf("changedFields of an unknown path = %q, want none", changed)
+	}
+}
+
+func TestReloadKeepsRestartOnlyFields(t *testing.T) {
+	bb, err := ioutil.ReadFile("config.default.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(replacements ...string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(strings.NewReplacer(replacements...).Replace(string(bb))), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write()
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloader(path, cfg)
+	var applied []Config
+	fail := false
+	r.OnReload(func(cfg Config) error {
+		applied = append(applied, cfg)
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	write("expiry_check_interval: 10m", "expiry_check_interval: 5m", "max_email_tries: 3", "max_email_tries: 5")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := r.Config(); got.ExpiryCheckInterval != "10m" || got.MaxEmailTries != 5 {
+		t.Errorf("config after reload has expiry_check_interval %q and max_email_tries %d, want 10m and 5",
+			got.ExpiryCheckInterval, got.MaxEmailTries)
+	}
+	if len(applied) != 1 || applied[0].ExpiryCheckInterval != "10m" {
+		t.Errorf("callbacks got %+v, want the config in effect", applied)
+	}
+
+	// The change is still reported, as it has not taken effect.
+	if changed := changedFields(r.Config(), mustLoad(t, path), restartRequired); len(changed) != 1 {
+		t.Errorf("changedFields after reload = %q, want expiry_check_interval", changed)
+	}
+
+	fail = true
+	if err := r.Reload(); !errors.Is(err, ErrPartialReload) {
+		t.Errorf("Reload with failing callback = %v, want ErrPartialReload", err)
+	}
+}
+
+func mustLoad(t *testing.T, path string) Config {
+	t.Helper()
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
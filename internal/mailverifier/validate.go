@@ -0,0 +1,366 @@
+package mailverifier
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"golang.org/x/text/language"
+)
+
+// Validate checks the whole config and reports all invalid fields at once.
+// The keys of the returned validation.Errors are the yaml field names.
+func (cfg Config) Validate() error {
+	return validation.Errors{
+		"email_regex":              validation.Validate(cfg.EmailRegex, validation.Required, validation.By(isRegex)),
+		"verification_code_length": validation.Validate(cfg.VerificationCodeLength, validation.Required, validation.Min(1), validation.Max(64)),
+		"email_validity_duration":  validation.Validate(cfg.EmailValidityDuration, validation.Required, validation.By(isPositiveDuration)),
+		"expiry_check_interval":    validation.Validate(cfg.ExpiryCheckInterval, validation.By(isPositiveDuration)),
+		"max_email_tries":          validation.Validate(cfg.MaxEmailTries, validation.Required, validation.Min(1)),
+		"api":                      cfg.API.Validate(),
+		"email":                    cfg.Email.Validate(),
+		"database":                 cfg.Database.Validate(),
+		"metrics":                  cfg.Metrics.Validate(),
+		"log":                      cfg.Log.Validate(),
+		"tracing":                  cfg.Tracing.Validate(),
+		"reload":                   cfg.Reload.Validate(),
+		"auth":                     cfg.Auth.Validate(),
+		"webhooks":                 cfg.Webhooks.Validate(),
+		"events":                   cfg.Events.Validate(),
+		"grpc":                     cfg.GRPC.Validate(),
+		"bounces":                  cfg.Bounces.Validate(),
+		"notifications":            cfg.Notifications.Validate(),
+		"audit":                    cfg.Audit.Validate(),
+	}.Filter()
+}
+
+func (cfg APIConfig) Validate() error {
+	return validation.Errors{
+		"bind":                validation.Validate(cfg.Bind, validation.Required, validation.By(isBindAddress)),
+		"read_timeout":        validation.Validate(cfg.ReadTimeout, validation.By(isPositiveDuration)),
+		"read_header_timeout": validation.Validate(cfg.ReadHeaderTimeout, validation.By(isPositiveDuration)),
+		"write_timeout":       validation.Validate(cfg.WriteTimeout, validation.By(isPositiveDuration)),
+		"idle_timeout":        validation.Validate(cfg.IdleTimeout, validation.By(isPositiveDuration)),
+		"shutdown_timeout":    validation.Validate(cfg.ShutdownTimeout, validation.By(isPositiveDuration)),
+		"max_header_bytes":    validation.Validate(cfg.MaxHeaderBytes, validation.Min(0)),
+		"max_body_bytes":      validation.Validate(cfg.MaxBodyBytes, validation.Min(int64(0))),
+		"tls":                 cfg.TLS.Validate(),
+	}.Filter()
+}
+
+func (cfg TLSConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	requireFiles := validation.When(!cfg.SelfSigned, validation.Required)
+	requireCA := validation.When(cfg.ClientAuth != "" && cfg.ClientAuth != "none", validation.Required)
+	return validation.Errors{
+		"cert_file":      validation.Validate(cfg.CertFile, requireFiles),
+		"key_file":       validation.Validate(cfg.KeyFile, requireFiles),
+		"client_auth":    validation.Validate(cfg.ClientAuth, validation.In("none", "request", "require")),
+		"client_ca_file": validation.Validate(cfg.ClientCAFile, requireCA),
+	}.Filter()
+}
+
+func (cfg EmailConfig) Validate() error {
+	return validation.Errors{
+		"host":           validation.Validate(cfg.Host, validation.Required),
+		"smtp_host":      validation.Validate(cfg.SMTPHost, validation.Required, validation.By(isHostPort)),
+		"email":          validation.Validate(cfg.Email, validation.Required, is.EmailFormat),
+		"default_locale": validation.Validate(cfg.DefaultLocale, validation.By(isLocale)),
+		"template_dir":   validation.Validate(cfg.TemplateDir, validation.By(isTemplateDir)),
+		"dkim":           cfg.DKIM.Validate(),
+		"security": validation.Validate(cfg.Security, validation.In(mailer.SecurityNone,
+			mailer.SecuritySTARTTLS, mailer.SecuritySTARTTLSRequired, mailer.SecurityImplicitTLS)),
+		"auth_mechanism": validation.Validate(cfg.AuthMechanism, validation.In(mailer.AuthNone,
+			mailer.AuthPlain, mailer.AuthLogin, mailer.AuthCRAMMD5)),
+		"connect_timeout":   validation.Validate(cfg.ConnectTimeout, validation.By(isPositiveDuration)),
+		"timeout":           validation.Validate(cfg.Timeout, validation.By(isPositiveDuration)),
+		"pool_size":         validation.Validate(cfg.PoolSize, validation.Min(0)),
+		"pool_max_messages": validation.Validate(cfg.PoolMaxMessages, validation.Min(0)),
+		"pool_idle_timeout": validation.Validate(cfg.PoolIdleTimeout, validation.By(isPositiveDuration)),
+		"rate_limit":        cfg.RateLimit.Validate(),
+	}.Filter()
+}
+
+func (cfg EmailRateLimitConfig) Validate() error {
+	return validation.Errors{
+		"max_wait": validation.Validate(cfg.MaxWait, validation.By(isNonNegativeDuration)),
+		"global":   cfg.Global.Validate(),
+		"domain":   cfg.Domain.Validate(),
+		"address":  cfg.Address.Validate(),
+	}.Filter()
+}
+
+func (cfg RateLimitConfig) Validate() error {
+	return validation.Errors{
+		"limit": validation.Validate(cfg.Limit, validation.Min(0)),
+		"interval": validation.Validate(cfg.Interval,
+			validation.When(cfg.Limit > 0, validation.Required),
+			validation.By(isPositiveDuration)),
+		"burst": validation.Validate(cfg.Burst, validation.Min(0)),
+	}.Filter()
+}
+
+func (cfg DKIMConfig) Validate() error {
+	enabled := cfg.KeyFile != ""
+	return validation.Errors{
+		"domain":   validation.Validate(cfg.Domain, is.Domain),
+		"selector": validation.Validate(cfg.Selector, validation.When(enabled, validation.Required)),
+		"key_file": validation.Validate(cfg.KeyFile, validation.By(isDKIMKey)),
+		"headers": validation.Validate(cfg.Headers, validation.When(len(cfg.Headers) > 0,
+			validation.By(containsFrom))),
+	}.Filter()
+}
+
+func (cfg DatabaseConfig) Validate() error {
+	return validation.Errors{
+		"host":     validation.Validate(cfg.Host, validation.Required, validation.By(isHostPort)),
+		"database": validation.Validate(cfg.Database, validation.Required),
+		"username": validation.Validate(cfg.Username, validation.Required),
+	}.Filter()
+}
+
+func (cfg MetricsConfig) Validate() error {
+	return validation.Errors{
+		"path": validation.Validate(cfg.Path,
+			validation.When(cfg.Enabled, validation.Required),
+			validation.Match(regexp.MustCompile(`^/`)).Error("must start with /")),
+	}.Filter()
+}
+
+func (cfg LogConfig) Validate() error {
+	return validation.Errors{
+		"level":   validation.Validate(strings.ToLower(cfg.Level), validation.In("trace", "debug", "info", "warn", "error")),
+		"format":  validation.Validate(cfg.Format, validation.In("json", "console")),
+		"privacy": validation.Validate(cfg.Privacy, validation.In("plain", "redact", "hash")),
+	}.Filter()
+}
+
+func (cfg TracingConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return validation.Errors{
+		"exporter":     validation.Validate(cfg.Exporter, validation.Required, validation.In("otlp", "stdout")),
+		"endpoint":     validation.Validate(cfg.Endpoint, validation.By(isHostPort)),
+		"sample_ratio": validation.Validate(cfg.Ratio(), validation.Min(0.0), validation.Max(1.0)),
+	}.Filter()
+}
+
+func (cfg AuditConfig) Validate() error {
+	return validation.Errors{
+		"retention":      validation.Validate(cfg.Retention, validation.By(isNonNegativeDuration)),
+		"purge_interval": validation.Validate(cfg.PurgeInterval, validation.By(isPositiveDuration)),
+	}.Filter()
+}
+
+func (cfg ReloadConfig) Validate() error {
+	return validation.Errors{
+		"watch_interval": validation.Validate(cfg.WatchInterval, validation.By(isNonNegativeDuration)),
+	}.Filter()
+}
+
+func (cfg AuthConfig) Validate() error {
+	errs := validation.Errors{}
+	names := map[string]bool{}
+	for i, key := range cfg.Keys {
+		keyErrs := validation.Errors{
+			"name":   validation.Validate(key.Name, validation.Required),
+			"key":    validation.Validate(key.Key, validation.When(key.KeyFile == "", validation.Required), validation.Length(16, 0)),
+			"scopes": validation.Validate(key.Scopes, validation.Each(validation.In("admin"))),
+		}
+		if names[key.Name] {
+			keyErrs["name"] = errors.New("must be unique")
+		}
+		names[key.Name] = true
+		errs["keys["+strconv.Itoa(i)+"]"] = keyErrs.Filter()
+	}
+	return errs.Filter()
+}
+
+func (cfg WebhooksConfig) Validate() error {
+	errs := validation.Errors{
+		"timeout":         validation.Validate(cfg.Timeout, validation.By(isPositiveDuration)),
+		"max_attempts":    validation.Validate(cfg.MaxAttempts, validation.Min(0)),
+		"initial_backoff": validation.Validate(cfg.InitialBackoff, validation.By(isPositiveDuration)),
+		"max_backoff":     validation.Validate(cfg.MaxBackoff, validation.By(isPositiveDuration)),
+	}
+
+	eventTypes := make([]interface{}, len(events.Types))
+	for i, e := range events.Types {
+		eventTypes[i] = e
+	}
+
+	names := map[string]bool{}
+	for i, sub := range cfg.Subscriptions {
+		subErrs := validation.Errors{
+			"name":   validation.Validate(sub.Name, validation.Required),
+			"url":    validation.Validate(sub.URL, validation.Required, is.URL),
+			"secret": validation.Validate(sub.Secret, validation.Required, validation.Length(16, 0)),
+			"events": validation.Validate(sub.Events, validation.Each(validation.In(eventTypes...))),
+		}
+		if names[sub.Name] {
+			subErrs["name"] = errors.New("must be unique")
+		}
+		names[sub.Name] = true
+		errs["subscriptions["+strconv.Itoa(i)+"]"] = subErrs.Filter()
+	}
+	return errs.Filter()
+}
+
+func (cfg EventsConfig) Validate() error {
+	return validation.Errors{
+		"backend":             validation.Validate(cfg.Backend, validation.In("memory", "postgres")),
+		"max_stream_duration": validation.Validate(cfg.MaxStreamDuration, validation.By(isNonNegativeDuration)),
+	}.Filter()
+}
+
+func (cfg GRPCConfig) Validate() error {
+	return validation.Errors{
+		"bind": validation.Validate(cfg.Bind,
+			validation.When(cfg.Enabled, validation.Required),
+			validation.By(isBindAddress)),
+	}.Filter()
+}
+
+func (cfg BouncesConfig) Validate() error {
+	return validation.Errors{
+		"poll_interval": validation.Validate(cfg.PollInterval, validation.By(isPositiveDuration)),
+	}.Filter()
+}
+
+func (cfg NotificationsConfig) Validate() error {
+	return validation.Errors{
+		"expiry_reminder": cfg.ExpiryReminder.Validate(),
+	}.Filter()
+}
+
+func (cfg ExpiryReminderConfig) Validate() error {
+	return validation.Errors{
+		"before": validation.Validate(cfg.Before,
+			validation.When(cfg.Enabled, validation.Required),
+			validation.By(isPositiveDuration)),
+		"check_interval": validation.Validate(cfg.CheckInterval, validation.By(isPositiveDuration)),
+	}.Filter()
+}
+
+func isRegex(value interface{}) error {
+	s, _ := value.(string)
+	if _, err := regexp.Compile(s); err != nil {
+		return errors.New("must be a valid regular expression")
+	}
+	return nil
+}
+
+func isPositiveDuration(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("must be a valid duration like 30s or 4368h")
+	}
+	if d <= 0 {
+		return errors.New("must be positive")
+	}
+	return nil
+}
+
+func isNonNegativeDuration(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("must be a valid duration like 30s or 4368h")
+	}
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+func isLocale(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	if _, err := language.Parse(s); err != nil {
+		return errors.New("must be a locale like de or en-US")
+	}
+	return nil
+}
+
+// isTemplateDir parses the templates in the directory, so invalid
+// templates fail startup and reloads with the error of the template.
+func isTemplateDir(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	if _, err := mailer.LoadRegistry(s); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isDKIMKey(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	if _, err := mailer.LoadDKIMKey(s); err != nil {
+		return err
+	}
+	return nil
+}
+
+func containsFrom(value interface{}) error {
+	headers, _ := value.([]string)
+	for _, h := range headers {
+		if strings.EqualFold(h, "From") {
+			return nil
+		}
+	}
+	return errors.New("must contain From")
+}
+
+func isHostPort(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return errors.New("must be in the form host:port")
+	}
+	return nil
+}
+
+func isBindAddress(value interface{}) error {
+	s, _ := value.(string)
+	if strings.HasPrefix(s, "unix:") {
+		if strings.TrimPrefix(s, "unix:") == "" {
+			return errors.New("must contain a socket path after unix:")
+		}
+		return nil
+	}
+	return isHostPort(s)
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mailverifier"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	emailsSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "sent_total",
+		Help:      "Number of emails successfully handed to the SMTP server.",
+	})
+
+	emailsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "failed_total",
+		Help:      "Number of emails that could not be sent by failure reason.",
+	}, []string{"reason"})
+
+	emailsBounced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "bounced_total",
+		Help:      "Number of verification emails reported as bounced.",
+	})
+
+	emailsComplained = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "complained_total",
+		Help:      "Number of verification emails reported as spam or abuse.",
+	})
+
+	emailsThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "throttled_total",
+		Help:      "Number of emails delayed or rejected by a rate limit by scope and result.",
+	}, []string{"scope", "result"})
+
+	verificationsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "verification",
+		Name:      "created_total",
+		Help:      "Number of verifications created.",
+	})
+
+	verificationsCompleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "verification",
+		Name:      "completed_total",
+		Help:      "Number of verifications completed with a valid code.",
+	})
+
+	codeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "verification",
+		Name:      "code_failures_total",
+		Help:      "Number of failed code verification attempts by reason.",
+	}, []string{"reason"})
+
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "config",
+		Name:      "reloads_total",
+		Help:      "Number of config reloads by result.",
+	}, []string{"result"})
+
+	configLastReload = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "config",
+		Name:      "last_reload_success",
+		Help:      "Whether the last config reload succeeded.",
+	})
+)
+
+// Reasons used for failed code verifications.
+const (
+	CodeFailureInvalid   = "invalid_code"
+	CodeFailureNoPending = "no_pending_verification"
+)
+
+func EmailSent() {
+	emailsSent.Inc()
+}
+
+func EmailFailed(reason string) {
+	emailsFailed.WithLabelValues(reason).Inc()
+}
+
+func EmailBounced() {
+	emailsBounced.Inc()
+}
+
+func EmailComplained() {
+	emailsComplained.Inc()
+}
+
+// EmailThrottled counts an email that hit the rate limit of scope and
+// either waited or was rejected.
+func EmailThrottled(scope string, waited bool) {
+	if waited {
+		emailsThrottled.WithLabelValues(scope, "waited").Inc()
+		return
+	}
+	emailsThrottled.WithLabelValues(scope, "rejected").Inc()
+}
+
+func VerificationCreated() {
+	verificationsCreated.Inc()
+}
+
+func VerificationCompleted() {
+	verificationsCompleted.Inc()
+}
+
+func CodeVerificationFailed(reason string) {
+	codeFailures.WithLabelValues(reason).Inc()
+}
+
+func ConfigReloaded(success bool) {
+	if success {
+		configReloads.WithLabelValues("success").Inc()
+		configLastReload.Set(1)
+		return
+	}
+	configReloads.WithLabelValues("failure").Inc()
+	configLastReload.Set(0)
+}
+
+// ConfigReloadedPartially records a reload whose config was valid but
+// could not be applied completely.
+func ConfigReloadedPartially() {
+	configReloads.WithLabelValues("partial").Inc()
+	configLastReload.Set(0)
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records request counts and latencies labeled with the
+// chi route pattern instead of the raw path, so that player UUIDs
+// don't blow up the label cardinality.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,72 @@
+package player
+
+import (
+	"context"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/rs/zerolog/log"
+)
+
+// expiryBatchSize is the number of verifications expired at once.
+const expiryBatchSize = 100
+
+// RunExpiry records the expiry of verifications in the interval until
+// ctx is done.
+func (s *Service) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.ExpireVerifications(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed expiring verifications")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireVerifications records the expiry of the verifications by email
+// that are older than the email validity duration if ExpireByAge is set.
+// The players are unverified as soon as the validity ends, this makes the
+// expiry visible in the verification and publishes it. It returns the
+// number of expired verifications.
+func (s *Service) ExpireVerifications(ctx context.Context) (int, error) {
+	cfg := s.Config()
+	if !cfg.ExpireByAge {
+		return 0, nil
+	}
+
+	expired := 0
+	for ctx.Err() == nil {
+		vv, err := s.Repo.ExpireVerifications(ctx, cfg.EmailValidityDuration, expiryBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, v := range vv {
+			s.Audit.Record(ctx, audit.Event{
+				Action:         audit.ActionVerificationExpired,
+				PlayerUUID:     v.PlayerUUID,
+				VerificationID: v.ID,
+				Details:        map[string]interface{}{"expiredAt": v.ExpiredAt},
+			})
+			s.publish(ctx, events.TypeVerificationExpired, events.Data{
+				PlayerUUID:     v.PlayerUUID,
+				VerificationID: v.ID,
+				Method:         v.Method,
+			})
+		}
+		expired += len(vv)
+
+		if len(vv) < expiryBatchSize {
+			break
+		}
+	}
+	return expired, nil
+}
@@ -2,30 +2,21 @@ package player
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"math"
 	"net/http"
-	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/logging"
 	"github.com/hhn-mc/mailverifier/internal/mailer"
 )
 
-type DataRepo interface {
-	PlayerWithUUIDExists(uuid string) (bool, error)
-	PlayerByUUID(uuid string) (Player, error)
-	CreatePlayer(p *Player) error
-
-	Verifications(pUUID string) ([]Verification, error)
-	CreateVerification(v *Verification) error
-	LatestVerification(pUUID string) (Verification, bool, error)
-	CreateEmailVerification(ve VerificationEmail) error
-	VerifyVerification(vID uint64, code string) (bool, error)
-}
-
-func GetPlayerHandler(repo DataRepo) http.HandlerFunc {
+func GetPlayerHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		uuid := chi.URLParam(r, "uuid")
 		if err := validation.Validate(uuid, is.UUIDv4); err != nil {
@@ -33,27 +24,20 @@ func GetPlayerHandler(repo DataRepo) http.HandlerFunc {
 			return
 		}
 
-		alreadyExists, err := repo.PlayerWithUUIDExists(uuid)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		if !alreadyExists {
+		player, err := svc.Player(r.Context(), uuid)
+		if errors.Is(err, ErrPlayerNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-
-		player, err := repo.PlayerByUUID(uuid)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Str("player_uuid", uuid).Msg("Failed getting player")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(player); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding player")
 			return
 		}
 
@@ -61,7 +45,7 @@ func GetPlayerHandler(repo DataRepo) http.HandlerFunc {
 	}
 }
 
-func PostPlayerHandler(repo DataRepo) http.HandlerFunc {
+func PostPlayerHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var player Player
 		if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
@@ -69,31 +53,24 @@ func PostPlayerHandler(repo DataRepo) http.HandlerFunc {
 			return
 		}
 
-		if err := player.Validate(); err != nil {
+		err := svc.CreatePlayer(r.Context(), &player)
+		var validationErr ValidationError
+		switch {
+		case errors.As(err, &validationErr):
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
-		}
-
-		alreadyExists, err := repo.PlayerWithUUIDExists(player.UUID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		if alreadyExists {
+		case errors.Is(err, ErrPlayerExists):
 			w.WriteHeader(http.StatusConflict)
 			return
-		}
-
-		if err := repo.CreatePlayer(&player); err != nil {
+		case err != nil:
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Str("player_uuid", player.UUID).Msg("Failed creating player")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(player); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding player")
 			return
 		}
 
@@ -101,7 +78,7 @@ func PostPlayerHandler(repo DataRepo) http.HandlerFunc {
 	}
 }
 
-func GetVerificationsHandler(repo DataRepo) http.HandlerFunc {
+func GetVerificationsHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		uuid := chi.URLParam(r, "uuid")
 		if err := validation.Validate(uuid, is.UUIDv4); err != nil {
@@ -109,16 +86,16 @@ func GetVerificationsHandler(repo DataRepo) http.HandlerFunc {
 			return
 		}
 
-		verifications, err := repo.Verifications(uuid)
+		verifications, err := svc.Verifications(r.Context(), uuid)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed getting verifications")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(verifications); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding verifications")
 			return
 		}
 
@@ -126,7 +103,7 @@ func GetVerificationsHandler(repo DataRepo) http.HandlerFunc {
 	}
 }
 
-func PostVerificationHandler(repo DataRepo) http.HandlerFunc {
+func PostVerificationHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		uuid := chi.URLParam(r, "uuid")
 		if err := validation.Validate(uuid, is.UUIDv4); err != nil {
@@ -134,19 +111,16 @@ func PostVerificationHandler(repo DataRepo) http.HandlerFunc {
 			return
 		}
 
-		verification := Verification{
-			PlayerUUID: uuid,
-		}
-
-		if err := repo.CreateVerification(&verification); err != nil {
+		verification, err := svc.CreateVerification(r.Context(), uuid)
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed creating a verification")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(verification); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding verification")
 			return
 		}
 
@@ -154,118 +128,186 @@ func PostVerificationHandler(repo DataRepo) http.HandlerFunc {
 	}
 }
 
-func PostVerificationEmailHandler(cfg VerificationEmailConfig, mail mailer.Service, repo DataRepo) http.HandlerFunc {
-	emailRegex := regexp.MustCompile(cfg.EmailRegex)
+func PostVerificationEmailHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		uuid := r.Context().Value(CtxUUIDKey).(string)
-
 		var email VerificationEmail
 		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		if err := email.Validate(emailRegex); err != nil {
+		player := Player{
+			UUID:     r.Context().Value(CtxUUIDKey).(string),
+			Username: r.Context().Value(CtxUsernameKey).(string),
+		}
+		locale := email.Locale
+		if locale == "" {
+			locale = r.Header.Get("Accept-Language")
+		}
+		ve, err := svc.SendVerificationEmail(r.Context(), player, email.Email, locale)
+		var validationErr ValidationError
+		var rateLimitErr *mailer.RateLimitError
+		switch {
+		case errors.As(err, &validationErr):
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
-		}
-
-		verification, exists, err := repo.LatestVerification(uuid)
-		if err != nil {
+		case errors.Is(err, ErrMaxEmailTries):
+			http.Error(w, "Max email tries reached", http.StatusConflict)
+			return
+		case errors.Is(err, ErrAlreadyVerified):
+			http.Error(w, "Player already verified manually", http.StatusConflict)
+			return
+		case errors.As(err, &rateLimitErr):
+			retryAfter := int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Too many emails, retry later", http.StatusTooManyRequests)
+			return
+		case err != nil:
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("Failed getting the latest verification; ", err)
+			logging.FromRequest(r).Error().Err(err).
+				Uint64("verification_id", ve.VerificationID).
+				Str("email", logging.Email(email.Email)).
+				Msg("Failed sending verification email")
 			return
 		}
 
-		if !exists || verification.CreatedAt.Add(cfg.EmailValidityDuration).Before(time.Now()) {
-			verification = Verification{PlayerUUID: uuid}
-			if err := repo.CreateVerification(&verification); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Println("Failed creating a verification; ", err)
-				return
-			}
-		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
 
-		if len(verification.Emails) >= cfg.MaxEmailTries {
-			http.Error(w, "Max email tries reached", http.StatusConflict)
+func PostVerificationVerifyHandler(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var code VerificationEmailCode
+		if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		code, err := generateVerificationCode(cfg.VerificationCodeLength)
-		if err != nil {
-			http.Error(w, "Failed to create verification code", http.StatusInternalServerError)
-			log.Printf("Failed to create verification code; %s", err)
+		uuid := r.Context().Value(CtxUUIDKey).(string)
+		_, err := svc.Verify(r.Context(), uuid, code.Code)
+		var validationErr ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
-		}
-
-		expiresAt := time.Now().Add(cfg.EmailValidityDuration)
-		ve := VerificationEmail{
-			VerificationID: verification.ID,
-			Code:           code,
-			Email:          email.Email,
-			ExpiresAt:      &expiresAt,
-		}
-		if err := repo.CreateEmailVerification(ve); err != nil {
+		case errors.Is(err, ErrNoPendingVerification):
+			http.Error(w, "No pending verification", http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrInvalidCode):
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		case err != nil:
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("Failed creating email verification; ", err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed verifying code")
 			return
 		}
 
-		username := r.Context().Value(CtxUsernameKey).(string)
-		emailData := mailer.VerificationEmailData{
-			Code:     code,
-			UUID:     uuid,
-			Username: username,
-			Time:     time.Now().Format(time.RFC3339),
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func PostManualVerificationHandler(svc *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var action AdminAction
+		if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
-		if err := mail.SendVerificationEmail(emailData, email.Email); err != nil {
+
+		uuid := r.Context().Value(CtxUUIDKey).(string)
+		verification, err := svc.VerifyManually(r.Context(), uuid, action)
+		var validationErr ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("Failed sending email", err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed verifying player manually")
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(verification); err != nil {
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding verification")
+		}
 	}
 }
 
-func PostVerificationVerifyHandler(repo DataRepo) http.HandlerFunc {
+func PostRevokeVerificationHandler(svc *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var code VerificationEmailCode
-		if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		vID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid verification id", http.StatusBadRequest)
 			return
 		}
 
-		if err := code.Validate(); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		var action AdminAction
+		if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
 		uuid := r.Context().Value(CtxUUIDKey).(string)
-		validation, exists, err := repo.LatestVerification(uuid)
-		if err != nil {
+		verification, err := svc.Revoke(r.Context(), uuid, vID, action)
+		var validationErr ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrVerificationNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case errors.Is(err, ErrAlreadyRevoked):
+			http.Error(w, "Verification already revoked", http.StatusConflict)
+			return
+		case err != nil:
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("Failed getting the latest verification; ", err)
+			logging.FromRequest(r).Error().Err(err).
+				Uint64("verification_id", vID).
+				Msg("Failed revoking verification")
 			return
 		}
 
-		if !exists {
-			http.Error(w, "No pending verification", http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(verification); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding verification")
 			return
 		}
 
-		success, err := repo.VerifyVerification(validation.ID, code.Code)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetPlayerEventsHandler streams the lifecycle events of the player as
+// Server-Sent Events. The current state of the player is sent first as
+// player.status event, so clients do not miss changes while reconnecting.
+func GetPlayerEventsHandler(svc *Service, bus *events.Bus, maxDuration time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uuid := r.Context().Value(CtxUUIDKey).(string)
+
+		// Subscribe before reading the state to not miss events in between.
+		sub := bus.Subscribe(func(e events.Event) bool {
+			return e.Data.PlayerUUID == uuid
+		})
+		defer sub.Close()
+
+		player, err := svc.Player(r.Context(), uuid)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("Failed verifying code; ", err)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed getting player")
 			return
 		}
 
-		if !success {
-			http.Error(w, "Invalid code", http.StatusBadRequest)
+		stream, err := events.NewStream(w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		if err := stream.Send("", "player.status", player); err != nil {
+			return
+		}
+		stream.Serve(r, sub, maxDuration)
 	}
 }
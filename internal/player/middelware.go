@@ -2,12 +2,12 @@ package player
 
 import (
 	"context"
-	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/logging"
 )
 
 type ctxKey int
@@ -26,9 +26,10 @@ func ByUUIDMiddleware(repo DataRepo) func(h http.Handler) http.Handler {
 				return
 			}
 
-			alreadyExists, err := repo.PlayerWithUUIDExists(uuid)
+			alreadyExists, err := repo.PlayerWithUUIDExists(r.Context(), uuid)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
+				logging.FromRequest(r).Error().Err(err).Msg("Failed checking if player exists")
 				return
 			}
 
@@ -37,14 +38,17 @@ func ByUUIDMiddleware(repo DataRepo) func(h http.Handler) http.Handler {
 				return
 			}
 
-			player, err := repo.PlayerByUUID(uuid)
+			player, err := repo.PlayerByUUID(r.Context(), uuid)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
-				log.Println(err)
+				logging.FromRequest(r).Error().Err(err).Str("player_uuid", uuid).Msg("Failed getting player")
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), CtxUUIDKey, player.UUID)
+			ctx := logging.WithFields(r.Context(), map[string]interface{}{
+				"player_uuid": player.UUID,
+			})
+			ctx = context.WithValue(ctx, CtxUUIDKey, player.UUID)
 			ctx = context.WithValue(ctx, CtxUsernameKey, player.Username)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -0,0 +1,169 @@
+package player
+
+import (
+	"context"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/rs/zerolog/log"
+)
+
+// reminderBatchSize is the number of expiry reminders claimed at once.
+const reminderBatchSize = 50
+
+// notificationTimeout bounds sending a notification in the background.
+const notificationTimeout = time.Minute
+
+// notify runs fn in the background with a context detached from the
+// request, so sending emails does not delay the response.
+func (s *Service) notify(ctx context.Context, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(logging.Ctx(ctx).WithContext(context.Background()), notificationTimeout)
+	s.notifications.Add(1)
+	go func() {
+		defer s.notifications.Done()
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// Wait waits for the notifications sent in the background.
+func (s *Service) Wait() {
+	s.notifications.Wait()
+}
+
+// notifyVerified confirms the verification to the verified address.
+// Failures are only logged, the verification stays completed.
+func (s *Service) notifyVerified(ctx context.Context, uuid string, email VerificationEmail) {
+	p, err := s.Player(ctx, uuid)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed getting player for verified email")
+		return
+	}
+
+	data := mailer.VerifiedEmailData{
+		Username: p.Username,
+		UUID:     p.UUID,
+		Email:    email.Email,
+		Time:     time.Now().Format(time.RFC3339),
+		Locale:   email.Locale,
+	}
+	if err := s.Mailer.SendVerifiedEmail(ctx, data, email.Email); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed sending verified email")
+	}
+}
+
+// notifyRevoked informs every address v was verified with. Failures are
+// only logged, the verification stays revoked.
+func (s *Service) notifyRevoked(ctx context.Context, v Verification) {
+	p, err := s.Player(ctx, v.PlayerUUID)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed getting player for revoked email")
+		return
+	}
+
+	for _, email := range v.Emails {
+		if email.VerifiedAt == nil {
+			continue
+		}
+
+		data := mailer.RevokedEmailData{
+			Username: p.Username,
+			UUID:     p.UUID,
+			Email:    email.Email,
+			Reason:   v.RevokeReason,
+			Time:     v.RevokedAt.Format(time.RFC3339),
+			Locale:   email.Locale,
+		}
+		if err := s.Mailer.SendRevokedEmail(ctx, data, email.Email); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("Failed sending revoked email")
+		}
+	}
+}
+
+// RunExpiryReminders sends the due expiry reminders in the interval
+// until ctx is done. The config is checked on every run, so reminders
+// can be enabled by a reload.
+func (s *Service) RunExpiryReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.SendExpiryReminders(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed sending expiry reminders")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendExpiryReminders reminds the players whose latest verification
+// expires within the configured reminder duration to verify again.
+// Verifications only expire and are reminded if ExpireByAge is set.
+// Every verification is reminded once; reminders that failed to send
+// are retried on the next run. It returns the number of sent reminders.
+func (s *Service) SendExpiryReminders(ctx context.Context) (int, error) {
+	cfg := s.Config()
+	if cfg.Notifications.ExpiryReminder <= 0 || !cfg.ExpireByAge {
+		return 0, nil
+	}
+
+	sent := 0
+	for ctx.Err() == nil {
+		expiring, err := s.Repo.ClaimExpiryReminders(ctx, cfg.EmailValidityDuration, cfg.Notifications.ExpiryReminder, reminderBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		for i, e := range expiring {
+			if err := s.sendExpiryReminder(ctx, e); err != nil {
+				// Released reminders would be claimed again right away,
+				// so the rest waits for the next run.
+				for _, unsent := range expiring[i:] {
+					if err := s.Repo.ReleaseExpiryReminder(ctx, unsent.VerificationID); err != nil {
+						log.Error().Err(err).Uint64("verification_id", unsent.VerificationID).Msg("Failed releasing expiry reminder")
+					}
+				}
+				return sent, err
+			}
+			sent++
+		}
+
+		if len(expiring) < reminderBatchSize {
+			break
+		}
+	}
+	return sent, nil
+}
+
+func (s *Service) sendExpiryReminder(ctx context.Context, e ExpiringVerification) error {
+	days := int((time.Until(e.ExpiresAt) + 24*time.Hour - 1) / (24 * time.Hour))
+	if days < 1 {
+		days = 1
+	}
+
+	data := mailer.ExpiryReminderEmailData{
+		Username:  e.Username,
+		UUID:      e.PlayerUUID,
+		Email:     e.Email,
+		ExpiresAt: e.ExpiresAt.Format(time.RFC3339),
+		Days:      days,
+		Locale:    e.Locale,
+	}
+	if err := s.Mailer.SendExpiryReminderEmail(ctx, data, e.Email); err != nil {
+		return err
+	}
+
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionExpiryReminderSent,
+		PlayerUUID:     e.PlayerUUID,
+		VerificationID: e.VerificationID,
+		Details:        map[string]interface{}{"email": e.Email, "expiresAt": e.ExpiresAt},
+	})
+	return nil
+}
@@ -22,3 +22,11 @@ func (player Player) Validate() error {
 
 	return validation.ValidateStruct(&player, fieldRules...)
 }
+
+// PlayerFilter restricts the players returned by a listing.
+// A nil Verified matches verified and unverified players.
+type PlayerFilter struct {
+	Verified *bool
+	Limit    int
+	Offset   int
+}
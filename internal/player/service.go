@@ -0,0 +1,573 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/audit"
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/metrics"
+	"github.com/hhn-mc/mailverifier/internal/webhook"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrPlayerNotFound        = errors.New("player not found")
+	ErrPlayerExists          = errors.New("player already exists")
+	ErrMaxEmailTries         = errors.New("max email tries reached")
+	ErrNoPendingVerification = errors.New("no pending verification")
+	ErrInvalidCode           = errors.New("invalid code")
+	ErrNoEmail               = errors.New("no email address to send to")
+	ErrVerificationNotFound  = errors.New("verification not found")
+	ErrAlreadyRevoked        = errors.New("verification already revoked")
+	ErrEmailNotFound         = errors.New("verification email not found")
+	ErrAlreadyVerified       = errors.New("player already verified manually")
+)
+
+// ValidationError wraps errors caused by invalid input.
+// Its message is safe to return to clients.
+type ValidationError struct {
+	Err error
+}
+
+func (err ValidationError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ValidationError) Unwrap() error {
+	return err.Err
+}
+
+type DataRepo interface {
+	PlayerWithUUIDExists(ctx context.Context, uuid string) (bool, error)
+	PlayerByUUID(ctx context.Context, uuid string) (Player, error)
+	Players(ctx context.Context, filter PlayerFilter) ([]Player, error)
+	CreatePlayer(ctx context.Context, p *Player) error
+	DeletePlayer(ctx context.Context, uuid string) error
+
+	Verifications(ctx context.Context, pUUID string) ([]Verification, error)
+	CreateVerification(ctx context.Context, v *Verification) error
+	LatestVerification(ctx context.Context, pUUID string) (Verification, bool, error)
+	Verification(ctx context.Context, pUUID string, vID uint64) (Verification, bool, error)
+	CreateManualVerification(ctx context.Context, v *Verification) error
+	RevokeVerification(ctx context.Context, vID uint64, by string, onBehalfOf string, reason string) (bool, error)
+	CreateEmailVerification(ctx context.Context, ve VerificationEmail) error
+	DeleteEmailVerification(ctx context.Context, vID uint64, code string) error
+	DeleteVerification(ctx context.Context, vID uint64) error
+	BounceVerificationEmail(ctx context.Context, messageID string, recipient string, reason string) (BouncedEmail, bool, error)
+	ComplainVerificationEmail(ctx context.Context, messageID string, recipient string, feedbackType string) (BouncedEmail, bool, error)
+	VerifyVerification(ctx context.Context, vID uint64, code string) (VerificationEmail, bool, error)
+	UnverifyVerification(ctx context.Context, vID uint64) error
+	ExpireVerification(ctx context.Context, vID uint64) error
+	ExpireVerifications(ctx context.Context, validity time.Duration, limit int) ([]Verification, error)
+	ClaimExpiryReminders(ctx context.Context, validity time.Duration, before time.Duration, limit int) ([]ExpiringVerification, error)
+	ReleaseExpiryReminder(ctx context.Context, vID uint64) error
+}
+
+type Mailer interface {
+	NewMessageID() (string, error)
+	CheckRateLimit(recipients ...string) error
+	SendVerificationEmail(ctx context.Context, data mailer.VerificationEmailData, sendTo ...string) error
+	SendVerifiedEmail(ctx context.Context, data mailer.VerifiedEmailData, sendTo ...string) error
+	SendExpiryReminderEmail(ctx context.Context, data mailer.ExpiryReminderEmailData, sendTo ...string) error
+	SendRevokedEmail(ctx context.Context, data mailer.RevokedEmailData, sendTo ...string) error
+}
+
+// Service implements the business rules around players and their
+// verifications. It is shared by the HTTP handlers and the admin CLI.
+type Service struct {
+	Repo   DataRepo
+	Mailer Mailer
+	// Config is called for every operation, so config reloads
+	// take effect immediately.
+	Config func() VerificationEmailConfig
+	// Audit records all state-changing actions if set.
+	Audit *audit.Log
+	// Webhooks and Events receive the lifecycle events if set.
+	Webhooks *webhook.Dispatcher
+	Events   *events.Bus
+
+	notifications sync.WaitGroup
+}
+
+func (s *Service) Player(ctx context.Context, uuid string) (Player, error) {
+	p, err := s.Repo.PlayerByUUID(ctx, uuid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Player{}, ErrPlayerNotFound
+	}
+	return p, err
+}
+
+func (s *Service) Players(ctx context.Context, filter PlayerFilter) ([]Player, error) {
+	return s.Repo.Players(ctx, filter)
+}
+
+func (s *Service) CreatePlayer(ctx context.Context, p *Player) error {
+	if err := p.Validate(); err != nil {
+		return ValidationError{err}
+	}
+
+	exists, err := s.Repo.PlayerWithUUIDExists(ctx, p.UUID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrPlayerExists
+	}
+
+	if err := s.Repo.CreatePlayer(ctx, p); err != nil {
+		return err
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:     audit.ActionPlayerCreated,
+		PlayerUUID: p.UUID,
+		Details:    map[string]interface{}{"username": p.Username},
+	})
+	s.publish(ctx, events.TypePlayerCreated, events.Data{
+		PlayerUUID: p.UUID,
+		Username:   p.Username,
+	})
+	return nil
+}
+
+func (s *Service) DeletePlayer(ctx context.Context, uuid string) error {
+	if _, err := s.Player(ctx, uuid); err != nil {
+		return err
+	}
+	if err := s.Repo.DeletePlayer(ctx, uuid); err != nil {
+		return err
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:     audit.ActionPlayerDeleted,
+		PlayerUUID: uuid,
+	})
+	return nil
+}
+
+func (s *Service) Verifications(ctx context.Context, uuid string) ([]Verification, error) {
+	return s.Repo.Verifications(ctx, uuid)
+}
+
+func (s *Service) CreateVerification(ctx context.Context, uuid string) (Verification, error) {
+	v := Verification{PlayerUUID: uuid}
+	if err := s.Repo.CreateVerification(ctx, &v); err != nil {
+		return Verification{}, err
+	}
+	s.verificationCreated(ctx, v)
+	return v, nil
+}
+
+func (s *Service) verificationCreated(ctx context.Context, v Verification) {
+	metrics.VerificationCreated()
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionVerificationCreated,
+		PlayerUUID:     v.PlayerUUID,
+		VerificationID: v.ID,
+	})
+}
+
+// publish passes a lifecycle event to the webhooks and the event bus.
+func (s *Service) publish(ctx context.Context, eventType string, data events.Data) {
+	e, err := events.New(eventType, data)
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Str("event_type", eventType).Msg("Failed creating event")
+		return
+	}
+
+	s.Webhooks.Publish(ctx, e)
+	s.Events.Publish(ctx, e)
+}
+
+// isClosed reports whether a new verification has to be started
+// instead of adding emails to v.
+func (s *Service) isClosed(v Verification, cfg VerificationEmailConfig) bool {
+	return v.Method == MethodManual ||
+		v.ExpiredAt != nil ||
+		v.RevokedAt != nil ||
+		v.CreatedAt.Add(cfg.EmailValidityDuration).Before(time.Now())
+}
+
+// isManuallyVerified reports whether v is a manual verification that is
+// still in effect. Starting a new verification would unverify the player.
+func isManuallyVerified(v Verification) bool {
+	return v.Method == MethodManual && v.VerifiedAt != nil && v.ExpiredAt == nil && v.RevokedAt == nil
+}
+
+// discardEmail deletes a verification email that was rate limited after
+// all, so that it does not count as try. A verification created for it
+// is deleted as well, as it would replace the latest one.
+func (s *Service) discardEmail(ctx context.Context, ve VerificationEmail, created bool) {
+	var err error
+	if created {
+		err = s.Repo.DeleteVerification(ctx, ve.VerificationID)
+	} else {
+		err = s.Repo.DeleteEmailVerification(ctx, ve.VerificationID, ve.Code)
+	}
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msg("Failed deleting rate limited verification email")
+	}
+}
+
+// SendVerificationEmail sends a new code to email in the preferred
+// locale, which may be empty for the default locale. A new verification
+// is started if the player has none or the latest one expired. Players
+// verified manually get ErrAlreadyVerified until that is revoked.
+func (s *Service) SendVerificationEmail(ctx context.Context, p Player, email string, locale string) (VerificationEmail, error) {
+	cfg := s.Config()
+
+	ve := VerificationEmail{Email: email, Locale: locale}
+	if err := ve.Validate(cfg.EmailRegex); err != nil {
+		return VerificationEmail{}, ValidationError{err}
+	}
+
+	verification, exists, err := s.Repo.LatestVerification(ctx, p.UUID)
+	if err != nil {
+		return VerificationEmail{}, err
+	}
+
+	if exists && isManuallyVerified(verification) {
+		return VerificationEmail{}, ErrAlreadyVerified
+	}
+	created := !exists || s.isClosed(verification, cfg)
+	tries := 0
+	if !created {
+		tries = verification.EmailTries()
+	}
+	if tries >= cfg.MaxEmailTries {
+		return VerificationEmail{}, ErrMaxEmailTries
+	}
+
+	// A new verification replaces the latest one, so it is only
+	// created if the email is not rate limited.
+	if err := s.Mailer.CheckRateLimit(email); err != nil {
+		return VerificationEmail{}, err
+	}
+	if created {
+		verification = Verification{PlayerUUID: p.UUID}
+		if err := s.Repo.CreateVerification(ctx, &verification); err != nil {
+			return VerificationEmail{}, err
+		}
+	}
+
+	code, err := generateVerificationCode(cfg.VerificationCodeLength)
+	if err != nil {
+		return VerificationEmail{}, err
+	}
+
+	messageID, err := s.Mailer.NewMessageID()
+	if err != nil {
+		return VerificationEmail{}, err
+	}
+
+	expiresAt := time.Now().Add(cfg.EmailValidityDuration)
+	ve = VerificationEmail{
+		VerificationID: verification.ID,
+		Code:           code,
+		Email:          email,
+		Locale:         locale,
+		MessageID:      messageID,
+		ExpiresAt:      &expiresAt,
+	}
+	if err := s.Repo.CreateEmailVerification(ctx, ve); err != nil {
+		return VerificationEmail{}, err
+	}
+
+	emailData := mailer.VerificationEmailData{
+		Code:     code,
+		UUID:     p.UUID,
+		Username: p.Username,
+		Time:     time.Now().Format(time.RFC3339),
+		Locale:   locale,
+
+		MessageID: messageID,
+	}
+	if err := s.Mailer.SendVerificationEmail(ctx, emailData, email); err != nil {
+		if errors.Is(err, mailer.ErrRateLimited) {
+			s.discardEmail(ctx, ve, created)
+		} else if created {
+			s.verificationCreated(ctx, verification)
+		}
+		return ve, err
+	}
+	if created {
+		s.verificationCreated(ctx, verification)
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionEmailSent,
+		PlayerUUID:     p.UUID,
+		VerificationID: verification.ID,
+		Details:        map[string]interface{}{"email": email},
+	})
+	s.publish(ctx, events.TypeVerificationEmailSent, events.Data{
+		PlayerUUID:     p.UUID,
+		Username:       p.Username,
+		VerificationID: verification.ID,
+		Method:         verification.Method,
+	})
+
+	return ve, nil
+}
+
+// ResendVerificationEmail sends a new code to the address and in the
+// locale the player used last, counting against the same email tries.
+func (s *Service) ResendVerificationEmail(ctx context.Context, p Player) (VerificationEmail, error) {
+	verification, exists, err := s.Repo.LatestVerification(ctx, p.UUID)
+	if err != nil {
+		return VerificationEmail{}, err
+	}
+
+	if !exists || len(verification.Emails) == 0 {
+		return VerificationEmail{}, ErrNoEmail
+	}
+
+	last := verification.Emails[len(verification.Emails)-1]
+	return s.SendVerificationEmail(ctx, p, last.Email, last.Locale)
+}
+
+// RecordBounce marks the email with messageID, or without messageID the
+// latest email sent to recipient, as bounced. Bounced emails do not
+// count against the max email tries, so the player can try another
+// address.
+func (s *Service) RecordBounce(ctx context.Context, messageID string, recipient string, reason string) (BouncedEmail, error) {
+	b, ok, err := s.Repo.BounceVerificationEmail(ctx, messageID, recipient, reason)
+	if err != nil {
+		return BouncedEmail{}, err
+	}
+	if !ok {
+		return BouncedEmail{}, ErrEmailNotFound
+	}
+
+	metrics.EmailBounced()
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionEmailBounced,
+		PlayerUUID:     b.PlayerUUID,
+		VerificationID: b.VerificationID,
+		Details:        map[string]interface{}{"email": b.Email, "reason": reason},
+	})
+	s.publish(ctx, events.TypeVerificationBounced, events.Data{
+		PlayerUUID:     b.PlayerUUID,
+		VerificationID: b.VerificationID,
+		Reason:         reason,
+	})
+	return b, nil
+}
+
+// RecordComplaint marks the email with messageID, or without messageID
+// the latest email sent to recipient, as complained about. Unlike
+// bounces, complaints still count against the max email tries.
+func (s *Service) RecordComplaint(ctx context.Context, messageID string, recipient string, feedbackType string) (BouncedEmail, error) {
+	b, ok, err := s.Repo.ComplainVerificationEmail(ctx, messageID, recipient, feedbackType)
+	if err != nil {
+		return BouncedEmail{}, err
+	}
+	if !ok {
+		return BouncedEmail{}, ErrEmailNotFound
+	}
+
+	metrics.EmailComplained()
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionEmailComplained,
+		PlayerUUID:     b.PlayerUUID,
+		VerificationID: b.VerificationID,
+		Details:        map[string]interface{}{"email": b.Email, "feedbackType": feedbackType},
+	})
+	return b, nil
+}
+
+// Verify completes the latest verification of the player with code.
+func (s *Service) Verify(ctx context.Context, uuid string, code string) (Verification, error) {
+	c := VerificationEmailCode{Code: code}
+	if err := c.Validate(); err != nil {
+		return Verification{}, ValidationError{err}
+	}
+
+	verification, exists, err := s.Repo.LatestVerification(ctx, uuid)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if !exists || verification.RevokedAt != nil || verification.Method == MethodManual {
+		metrics.CodeVerificationFailed(metrics.CodeFailureNoPending)
+		s.recordCodeAttempt(ctx, uuid, 0, metrics.CodeFailureNoPending)
+		return Verification{}, ErrNoPendingVerification
+	}
+
+	email, success, err := s.Repo.VerifyVerification(ctx, verification.ID, code)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if !success {
+		metrics.CodeVerificationFailed(metrics.CodeFailureInvalid)
+		s.recordCodeAttempt(ctx, uuid, verification.ID, metrics.CodeFailureInvalid)
+		return Verification{}, ErrInvalidCode
+	}
+	metrics.VerificationCompleted()
+	s.recordCodeAttempt(ctx, uuid, verification.ID, "")
+	s.publish(ctx, events.TypeVerificationCompleted, events.Data{
+		PlayerUUID:     uuid,
+		VerificationID: verification.ID,
+		Method:         verification.Method,
+	})
+	if s.Config().Notifications.Verified {
+		s.notify(ctx, func(ctx context.Context) { s.notifyVerified(ctx, uuid, email) })
+	}
+
+	return verification, nil
+}
+
+// recordCodeAttempt records a code attempt, which failed
+// if reason is set.
+func (s *Service) recordCodeAttempt(ctx context.Context, uuid string, vID uint64, reason string) {
+	details := map[string]interface{}{"success": reason == ""}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionCodeAttempt,
+		PlayerUUID:     uuid,
+		VerificationID: vID,
+		Details:        details,
+	})
+}
+
+// Unverify resets the latest verification, whether it was verified
+// manually or by email.
+func (s *Service) Unverify(ctx context.Context, uuid string) (Verification, error) {
+	verification, exists, err := s.Repo.LatestVerification(ctx, uuid)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if !exists {
+		return Verification{}, ErrNoPendingVerification
+	}
+
+	if err := s.Repo.UnverifyVerification(ctx, verification.ID); err != nil {
+		return Verification{}, err
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionVerificationReset,
+		PlayerUUID:     uuid,
+		VerificationID: verification.ID,
+		Details:        map[string]interface{}{"method": verification.Method},
+	})
+	return verification, nil
+}
+
+// ExpireVerification expires the latest verification of the player.
+func (s *Service) ExpireVerification(ctx context.Context, uuid string) (Verification, error) {
+	verification, exists, err := s.Repo.LatestVerification(ctx, uuid)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if !exists || verification.ExpiredAt != nil {
+		return Verification{}, ErrNoPendingVerification
+	}
+
+	if err := s.Repo.ExpireVerification(ctx, verification.ID); err != nil {
+		return Verification{}, err
+	}
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionVerificationExpired,
+		PlayerUUID:     uuid,
+		VerificationID: verification.ID,
+	})
+	s.publish(ctx, events.TypeVerificationExpired, events.Data{
+		PlayerUUID:     uuid,
+		VerificationID: verification.ID,
+		Method:         verification.Method,
+	})
+	return verification, nil
+}
+
+// VerifyManually verifies the player without an email, e.g. for guests.
+func (s *Service) VerifyManually(ctx context.Context, uuid string, action AdminAction) (Verification, error) {
+	if err := action.Validate(); err != nil {
+		return Verification{}, ValidationError{err}
+	}
+
+	v := Verification{
+		PlayerUUID:         uuid,
+		Method:             MethodManual,
+		Reason:             action.Reason,
+		VerifiedBy:         auth.Actor(ctx),
+		VerifiedOnBehalfOf: action.Actor,
+	}
+	if err := s.Repo.CreateManualVerification(ctx, &v); err != nil {
+		return Verification{}, err
+	}
+	v.IsVerified = true
+	metrics.VerificationCreated()
+	metrics.VerificationCompleted()
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionManualVerification,
+		PlayerUUID:     uuid,
+		VerificationID: v.ID,
+		Details:        map[string]interface{}{"reason": v.Reason, "onBehalfOf": v.VerifiedOnBehalfOf},
+	})
+	s.publish(ctx, events.TypeVerificationCompleted, events.Data{
+		PlayerUUID:     uuid,
+		VerificationID: v.ID,
+		Method:         v.Method,
+		Reason:         v.Reason,
+	})
+
+	return v, nil
+}
+
+// Revoke revokes a verification of the player. If it is the latest
+// verification, the player is no longer verified.
+func (s *Service) Revoke(ctx context.Context, uuid string, vID uint64, action AdminAction) (Verification, error) {
+	if err := action.Validate(); err != nil {
+		return Verification{}, ValidationError{err}
+	}
+
+	v, exists, err := s.Repo.Verification(ctx, uuid, vID)
+	if err != nil {
+		return Verification{}, err
+	}
+	if !exists {
+		return Verification{}, ErrVerificationNotFound
+	}
+
+	by := auth.Actor(ctx)
+	revoked, err := s.Repo.RevokeVerification(ctx, vID, by, action.Actor, action.Reason)
+	if err != nil {
+		return Verification{}, err
+	}
+	if !revoked {
+		return Verification{}, ErrAlreadyRevoked
+	}
+
+	wasVerified := v.IsVerified
+	now := time.Now()
+	v.RevokedAt = &now
+	v.RevokedBy = by
+	v.RevokedOnBehalfOf = action.Actor
+	v.RevokeReason = action.Reason
+	v.IsVerified = false
+	s.Audit.Record(ctx, audit.Event{
+		Action:         audit.ActionVerificationRevoked,
+		PlayerUUID:     uuid,
+		VerificationID: v.ID,
+		Details:        map[string]interface{}{"reason": v.RevokeReason, "onBehalfOf": v.RevokedOnBehalfOf},
+	})
+	s.publish(ctx, events.TypeVerificationRevoked, events.Data{
+		PlayerUUID:     uuid,
+		VerificationID: v.ID,
+		Method:         v.Method,
+		Reason:         v.RevokeReason,
+	})
+	if wasVerified && s.Config().Notifications.Revoked {
+		s.notify(ctx, func(ctx context.Context) { s.notifyRevoked(ctx, v) })
+	}
+
+	return v, nil
+}
@@ -10,12 +10,61 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
+const (
+	MethodEmail  = "email"
+	MethodManual = "manual"
+)
+
 type Verification struct {
 	ID         uint64              `json:"id"`
 	PlayerUUID string              `json:"playerUuid,omitempty"`
+	Method     string              `json:"method"`
 	Emails     []VerificationEmail `json:"emails,omitempty"`
 	IsVerified bool                `json:"isVerified"`
-	CreatedAt  time.Time           `json:"createdAt"`
+	// Reason, VerifiedAt and VerifiedBy are only set
+	// for manual verifications.
+	Reason     string     `json:"reason,omitempty"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	VerifiedBy string     `json:"verifiedBy,omitempty"`
+	// VerifiedOnBehalfOf and RevokedOnBehalfOf are the actors named by
+	// the caller, VerifiedBy and RevokedBy the names of the API keys.
+	VerifiedOnBehalfOf string     `json:"verifiedOnBehalfOf,omitempty"`
+	RevokedAt          *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy          string     `json:"revokedBy,omitempty"`
+	RevokedOnBehalfOf  string     `json:"revokedOnBehalfOf,omitempty"`
+	RevokeReason       string     `json:"revokeReason,omitempty"`
+	ExpiredAt          *time.Time `json:"expiredAt,omitempty"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
+
+// EmailTries returns the number of emails counting against the max
+// email tries. Bounced emails are refunded, emails the recipient
+// complained about are not, as they were delivered.
+func (v Verification) EmailTries() int {
+	tries := 0
+	for _, e := range v.Emails {
+		if e.BouncedAt == nil {
+			tries++
+		}
+	}
+	return tries
+}
+
+// AdminAction is the body of manual verifications and revocations.
+type AdminAction struct {
+	Reason string `json:"reason"`
+	// Actor names the person behind the API key. It is recorded as
+	// on behalf of, the actor is always the name of the key.
+	Actor string `json:"actor"`
+}
+
+func (action AdminAction) Validate() error {
+	fieldRules := []*validation.FieldRules{
+		validation.Field(&action.Reason, validation.Required, validation.Length(1, 500)),
+		validation.Field(&action.Actor, validation.Length(0, 100)),
+	}
+
+	return validation.ValidateStruct(&action, fieldRules...)
 }
 
 type VerificationEmail struct {
@@ -23,18 +72,51 @@ type VerificationEmail struct {
 	Email          string     `json:"email"`
 	Code           string     `json:"code"`
 	VerifiedAt     *time.Time `json:"verifiedAt,omitempty"`
+	BouncedAt      *time.Time `json:"bouncedAt,omitempty"`
+	BounceReason   string     `json:"bounceReason,omitempty"`
 	ExpiresAt      *time.Time `json:"expiresAt"`
 	CreatedAt      time.Time  `json:"createdAt"`
+
+	// ComplainedAt is set if the recipient reported the email as spam
+	// or abuse, ComplaintType is the feedback type of the report.
+	ComplainedAt  *time.Time `json:"complainedAt,omitempty"`
+	ComplaintType string     `json:"complaintType,omitempty"`
+
+	// Locale is the requested locale of the email, either a locale
+	// like de-DE or an Accept-Language header.
+	Locale string `json:"locale,omitempty"`
+	// MessageID is the Message-ID header of the email, which bounces
+	// refer to.
+	MessageID string `json:"-"`
+}
+
+// BouncedEmail is a verification email the recipient's server rejected
+// or the recipient complained about.
+type BouncedEmail struct {
+	PlayerUUID string
+	VerificationEmail
 }
 
 func (email VerificationEmail) Validate(emailRegex *regexp.Regexp) error {
 	fieldRules := []*validation.FieldRules{
 		validation.Field(&email.Email, validation.Required, validation.Match(emailRegex)),
+		validation.Field(&email.Locale, validation.Length(0, 100)),
 	}
 
 	return validation.ValidateStruct(&email, fieldRules...)
 }
 
+// ExpiringVerification is a verification that expires soon and the
+// address it was verified with.
+type ExpiringVerification struct {
+	PlayerUUID     string
+	Username       string
+	VerificationID uint64
+	Email          string
+	Locale         string
+	ExpiresAt      time.Time
+}
+
 type VerificationEmailCode struct {
 	Code string `json:"code"`
 }
@@ -57,8 +139,21 @@ func generateVerificationCode(length int) (string, error) {
 }
 
 type VerificationEmailConfig struct {
-	EmailRegex             string
+	EmailRegex             *regexp.Regexp
 	VerificationCodeLength int
 	EmailValidityDuration  time.Duration
 	MaxEmailTries          int
+	Notifications          NotificationConfig
+	// ExpireByAge ends verifications by email after EmailValidityDuration.
+	ExpireByAge bool
+}
+
+// NotificationConfig enables the emails sent to players in addition to
+// the verification codes.
+type NotificationConfig struct {
+	Verified bool
+	Revoked  bool
+	// ExpiryReminder is how long before the end of EmailValidityDuration
+	// players are reminded to verify again, 0 disables reminders.
+	ExpiryReminder time.Duration
 }
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// parseFilter reads the filter from the query parameters subscription,
+// eventType, status, limit and offset.
+func parseFilter(r *http.Request) (DeliveryFilter, error) {
+	q := r.URL.Query()
+	filter := DeliveryFilter{
+		Subscription: q.Get("subscription"),
+		EventType:    q.Get("eventType"),
+		Status:       q.Get("status"),
+		Limit:        defaultLimit,
+	}
+
+	errs := validation.Errors{
+		"status": validation.Validate(filter.Status, validation.In(StatusPending, StatusDelivered, StatusFailed)),
+		"limit":  validation.Validate(q.Get("limit"), is.Int),
+		"offset": validation.Validate(q.Get("offset"), is.Int),
+	}
+	if err := errs.Filter(); err != nil {
+		return DeliveryFilter{}, err
+	}
+
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(q.Get("offset")); err == nil {
+		filter.Offset = offset
+	}
+
+	return filter, validation.Errors{
+		"limit":  validation.Validate(filter.Limit, validation.Min(1), validation.Max(maxLimit)),
+		"offset": validation.Validate(filter.Offset, validation.Min(0)),
+	}.Filter()
+}
+
+func GetDeliveriesHandler(d *Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		deliveries, err := d.Repo.WebhookDeliveries(r.Context(), filter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed getting webhook deliveries")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding webhook deliveries")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func PostReplayDeliveryHandler(d *Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+			return
+		}
+
+		delivery, err := d.Replay(r.Context(), id)
+		switch {
+		case errors.Is(err, ErrDeliveryNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case errors.Is(err, ErrUnknownSubscription):
+			http.Error(w, "Subscription no longer exists", http.StatusConflict)
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			logging.FromRequest(r).Error().Err(err).Uint64("delivery_id", id).Msg("Failed replaying webhook delivery")
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(delivery); err != nil {
+			logging.FromRequest(r).Error().Err(err).Msg("Failed encoding webhook delivery")
+		}
+	}
+}
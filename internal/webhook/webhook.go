@@ -0,0 +1,377 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/events"
+	"github.com/hhn-mc/mailverifier/internal/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrDeliveryNotFound    = errors.New("delivery not found")
+	ErrUnknownSubscription = errors.New("unknown subscription")
+)
+
+// Delivery is an event queued for or sent to a subscription.
+type Delivery struct {
+	ID             uint64          `json:"id"`
+	Subscription   string          `json:"subscription"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+type DeliveryFilter struct {
+	Subscription string
+	EventType    string
+	Status       string
+	Limit        int
+	Offset       int
+}
+
+type Repo interface {
+	CreateWebhookDelivery(ctx context.Context, d *Delivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that
+	// are due and postpones them by lease, so no other worker picks them
+	// up while they are being sent.
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d Delivery) error
+	WebhookDelivery(ctx context.Context, id uint64) (Delivery, bool, error)
+	WebhookDeliveries(ctx context.Context, filter DeliveryFilter) ([]Delivery, error)
+}
+
+type Subscription struct {
+	Name   string
+	URL    string
+	Secret string
+	// Events the subscription receives, all if empty.
+	Events []string
+}
+
+func (s Subscription) subscribed(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Config struct {
+	Subscriptions  []Subscription
+	Timeout        time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns the delay before the next attempt after attempts
+// failed attempts.
+func (cfg Config) backoff(attempts int) time.Duration {
+	d := cfg.InitialBackoff
+	for i := 1; i < attempts && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	return d
+}
+
+// batchSize is the number of deliveries sent concurrently.
+const batchSize = 16
+
+// pollInterval is how often the delivery log is checked for due retries.
+const pollInterval = 5 * time.Second
+
+// Dispatcher queues events in the delivery log and sends them to the
+// subscriptions in the background. Deliveries are persisted, so pending
+// retries survive restarts.
+type Dispatcher struct {
+	Repo   Repo
+	Client *http.Client
+
+	cfg  atomic.Value
+	wake chan struct{}
+}
+
+func NewDispatcher(repo Repo, cfg Config) *Dispatcher {
+	d := &Dispatcher{
+		Repo:   repo,
+		Client: &http.Client{},
+		wake:   make(chan struct{}, 1),
+	}
+	d.cfg.Store(cfg)
+	return d
+}
+
+// Reload replaces the config. Pending deliveries of removed
+// subscriptions fail on their next attempt.
+func (d *Dispatcher) Reload(cfg Config) {
+	d.cfg.Store(cfg)
+}
+
+func (d *Dispatcher) config() Config {
+	return d.cfg.Load().(Config)
+}
+
+// Publish queues e for all subscriptions receiving its type.
+// Failures are logged instead of returned, as the event has already
+// happened. A nil Dispatcher discards all events.
+func (d *Dispatcher) Publish(ctx context.Context, e events.Event) {
+	if d == nil {
+		return
+	}
+
+	logger := logging.Ctx(ctx).With().Str("event_type", e.Type).Logger()
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed encoding webhook event")
+		return
+	}
+
+	queued := false
+	for _, sub := range d.config().Subscriptions {
+		if !sub.subscribed(e.Type) {
+			continue
+		}
+
+		delivery := Delivery{
+			Subscription: sub.Name,
+			EventID:      e.ID,
+			EventType:    e.Type,
+			Payload:      payload,
+		}
+		if err := d.Repo.CreateWebhookDelivery(ctx, &delivery); err != nil {
+			logger.Error().Err(err).Str("subscription", sub.Name).Msg("Failed queuing webhook delivery")
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		d.notify()
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Replay queues a new delivery of the event of delivery id to the
+// same subscription.
+func (d *Dispatcher) Replay(ctx context.Context, id uint64) (Delivery, error) {
+	orig, exists, err := d.Repo.WebhookDelivery(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !exists {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	if _, ok := d.subscription(orig.Subscription); !ok {
+		return Delivery{}, ErrUnknownSubscription
+	}
+
+	delivery := Delivery{
+		Subscription: orig.Subscription,
+		EventID:      orig.EventID,
+		EventType:    orig.EventType,
+		Payload:      orig.Payload,
+	}
+	if err := d.Repo.CreateWebhookDelivery(ctx, &delivery); err != nil {
+		return Delivery{}, err
+	}
+	d.notify()
+
+	return delivery, nil
+}
+
+func (d *Dispatcher) subscription(name string) (Subscription, bool) {
+	for _, sub := range d.config().Subscriptions {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// Run sends due deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		cfg := d.config()
+		// The lease covers a full attempt, after which crashed
+		// attempts are picked up again.
+		deliveries, err := d.Repo.ClaimWebhookDeliveries(ctx, batchSize, 2*cfg.Timeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("Failed getting due webhook deliveries")
+			}
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery Delivery) {
+				defer wg.Done()
+				d.attempt(ctx, cfg, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// attempt sends delivery once and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, cfg Config, delivery Delivery) {
+	logger := log.With().
+		Uint64("delivery_id", delivery.ID).
+		Str("subscription", delivery.Subscription).
+		Str("event_type", delivery.EventType).
+		Logger()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+
+	sub, ok := d.subscription(delivery.Subscription)
+	if !ok {
+		delivery.LastError = ErrUnknownSubscription.Error()
+		delivery.Status = StatusFailed
+	} else {
+		statusCode, err := d.send(ctx, cfg, sub, delivery)
+		if ctx.Err() != nil {
+			// Shutting down; the lease expires and the attempt is repeated.
+			return
+		}
+		delivery.LastStatusCode = statusCode
+
+		switch {
+		case err == nil:
+			now := time.Now()
+			delivery.Status = StatusDelivered
+			delivery.DeliveredAt = &now
+		case delivery.Attempts >= cfg.MaxAttempts:
+			delivery.LastError = err.Error()
+			delivery.Status = StatusFailed
+		default:
+			delivery.LastError = err.Error()
+			next := time.Now().Add(cfg.backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	switch delivery.Status {
+	case StatusDelivered:
+		logger.Debug().Int("attempts", delivery.Attempts).Msg("Delivered webhook")
+	case StatusFailed:
+		logger.Warn().Int("attempts", delivery.Attempts).Str("error", delivery.LastError).Msg("Giving up on webhook delivery")
+	default:
+		logger.Info().Int("attempts", delivery.Attempts).Str("error", delivery.LastError).Msg("Failed delivering webhook, retrying")
+	}
+
+	if err := d.Repo.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		logger.Error().Err(err).Msg("Failed updating webhook delivery")
+	}
+}
+
+// Sign returns the signature of a payload sent at timestamp, the hex
+// encoded HMAC-SHA256 of "<timestamp>.<payload>".
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) send(ctx context.Context, cfg Config, sub Subscription, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mailverifier-webhook")
+	req.Header.Set("X-Mailverifier-Event", delivery.EventType)
+	req.Header.Set("X-Mailverifier-Delivery", strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set("X-Mailverifier-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Mailverifier-Signature", "sha256="+Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		// URLs like the ones of Discord contain a token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = logging.Secret(urlErr.URL)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
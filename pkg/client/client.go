@@ -0,0 +1,204 @@
+// Package client is the Go client of the mailverifier REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API at BaseURL. Its fields must not be changed
+// while requests are running.
+type Client struct {
+	BaseURL string
+	// APIKey is sent as Bearer token if set.
+	APIKey     string
+	HTTPClient *http.Client
+	// MaxRetries is the number of retries of failed requests. Requests
+	// are retried on network errors, 429 and 5xx responses; POST requests
+	// only on 429, 502, 503 and 504, where the server did not process them.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry. It doubles with
+	// every retry; a longer Retry-After of the server is waited instead.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps RetryBackoff. If the server sends a longer
+	// Retry-After, the error is returned instead of retrying early.
+	MaxRetryBackoff time.Duration
+}
+
+// New returns a client with default retry settings.
+func New(baseURL string, apiKey string) *Client {
+	return &Client{
+		BaseURL:         strings.TrimRight(baseURL, "/"),
+		APIKey:          apiKey,
+		HTTPClient:      &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:      3,
+		RetryBackoff:    500 * time.Millisecond,
+		MaxRetryBackoff: 30 * time.Second,
+	}
+}
+
+func (c *Client) CreatePlayer(ctx context.Context, p Player) (Player, error) {
+	body := struct {
+		UUID     string `json:"uuid"`
+		Username string `json:"username"`
+	}{p.UUID, p.Username}
+
+	var created Player
+	err := c.do(ctx, http.MethodPost, "/players", body, &created)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		apiErr.op = ErrPlayerExists
+	}
+	return created, err
+}
+
+func (c *Client) GetPlayer(ctx context.Context, uuid string) (Player, error) {
+	var p Player
+	err := c.do(ctx, http.MethodGet, "/players/"+url.PathEscape(uuid), nil, &p)
+	return p, err
+}
+
+// SendVerificationEmail sends a verification code to email in locale,
+// e.g. the client language of the player. The server's default locale is
+// used if it is empty. A new verification is started if the latest one
+// is closed.
+func (c *Client) SendVerificationEmail(ctx context.Context, uuid string, email string, locale string) error {
+	body := struct {
+		Email  string `json:"email"`
+		Locale string `json:"locale,omitempty"`
+	}{email, locale}
+	return c.do(ctx, http.MethodPost, "/players/"+url.PathEscape(uuid)+"/verification-emails", body, nil)
+}
+
+// Verify completes the latest verification of the player with code.
+func (c *Client) Verify(ctx context.Context, uuid string, code string) error {
+	body := struct {
+		Code string `json:"code"`
+	}{code}
+	return c.do(ctx, http.MethodPost, "/players/"+url.PathEscape(uuid)+"/verifications/verify", body, nil)
+}
+
+func (c *Client) ListVerifications(ctx context.Context, uuid string) ([]Verification, error) {
+	var verifications []Verification
+	err := c.do(ctx, http.MethodGet, "/players/"+url.PathEscape(uuid)+"/verifications", nil, &verifications)
+	return verifications, err
+}
+
+// do sends the request, retrying it if possible, and decodes the
+// response into out if it is not nil.
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body)
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			defer resp.Body.Close()
+			if out == nil {
+				return nil
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			err = newError(resp.StatusCode, respBody)
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+
+		if attempt >= c.MaxRetries || !retryable(method, err) || ctx.Err() != nil {
+			return err
+		}
+
+		if c.MaxRetryBackoff > 0 && retryAfter > c.MaxRetryBackoff {
+			return err
+		}
+		delay := backoff
+		if c.MaxRetryBackoff > 0 && delay > c.MaxRetryBackoff {
+			delay = c.MaxRetryBackoff
+		}
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		backoff *= 2
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mailverifier: %w", err)
+	}
+	return resp, nil
+}
+
+func retryable(method string, err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// Network errors; the request may have been processed.
+		return method == http.MethodGet
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return method == http.MethodGet && apiErr.StatusCode >= 500
+}
+
+// parseRetryAfter parses the Retry-After header in seconds or as date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
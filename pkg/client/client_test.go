@@ -0,0 +1,813 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hhn-mc/mailverifier/internal/auth"
+	"github.com/hhn-mc/mailverifier/internal/httpapi"
+	"github.com/hhn-mc/mailverifier/internal/mailer"
+	"github.com/hhn-mc/mailverifier/internal/player"
+	"github.com/hhn-mc/mailverifier/pkg/client"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testUUID = "8667ba71-b85a-4004-af54-457a9734eed7"
+	testKey  = "test-key-0123456789"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// fakeRepo is an in-memory player.DataRepo.
+type fakeRepo struct {
+	mu            sync.Mutex
+	players       map[string]player.Player
+	verifications []*player.Verification
+	codes         map[uint64]map[string]string
+	// failures makes the next calls of PlayerByUUID and CreatePlayer
+	// fail.
+	failures    int
+	createCalls int
+}
+
+var errFake = errors.New("fake repo failure")
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		players: map[string]player.Player{},
+		codes:   map[uint64]map[string]string{},
+	}
+}
+
+func (repo *fakeRepo) fail() bool {
+	if repo.failures > 0 {
+		repo.failures--
+		return true
+	}
+	return false
+}
+
+func (repo *fakeRepo) PlayerWithUUIDExists(ctx context.Context, uuid string) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	_, ok := repo.players[uuid]
+	return ok, nil
+}
+
+func (repo *fakeRepo) PlayerByUUID(ctx context.Context, uuid string) (player.Player, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.fail() {
+		return player.Player{}, errFake
+	}
+	p, ok := repo.players[uuid]
+	if !ok {
+		return player.Player{}, pgx.ErrNoRows
+	}
+	if v := repo.latest(uuid); v != nil {
+		p.IsVerified = repo.withEmails(*v).IsVerified
+	}
+	return p, nil
+}
+
+func (repo *fakeRepo) Players(ctx context.Context, filter player.PlayerFilter) ([]player.Player, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var pp []player.Player
+	for _, p := range repo.players {
+		pp = append(pp, p)
+	}
+	return pp, nil
+}
+
+func (repo *fakeRepo) CreatePlayer(ctx context.Context, p *player.Player) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.createCalls++
+	if repo.fail() {
+		return errFake
+	}
+	p.CreatedAt = time.Now()
+	repo.players[p.UUID] = *p
+	return nil
+}
+
+func (repo *fakeRepo) DeletePlayer(ctx context.Context, uuid string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	delete(repo.players, uuid)
+	return nil
+}
+
+func (repo *fakeRepo) latest(uuid string) *player.Verification {
+	for i := len(repo.verifications) - 1; i >= 0; i-- {
+		if repo.verifications[i].PlayerUUID == uuid {
+			return repo.verifications[i]
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) withEmails(v player.Verification) player.Verification {
+	v.Emails = append([]player.VerificationEmail(nil), v.Emails...)
+	v.IsVerified = v.VerifiedAt != nil
+	for _, e := range v.Emails {
+		if e.VerifiedAt != nil {
+			v.IsVerified = true
+		}
+	}
+	if v.RevokedAt != nil || v.ExpiredAt != nil {
+		v.IsVerified = false
+	}
+	return v
+}
+
+func (repo *fakeRepo) Verifications(ctx context.Context, pUUID string) ([]player.Verification, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var vv []player.Verification
+	for _, v := range repo.verifications {
+		if v.PlayerUUID == pUUID {
+			vv = append(vv, repo.withEmails(*v))
+		}
+	}
+	return vv, nil
+}
+
+func (repo *fakeRepo) CreateVerification(ctx context.Context, v *player.Verification) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	v.ID = uint64(len(repo.verifications) + 1)
+	if v.Method == "" {
+		v.Method = player.MethodEmail
+	}
+	v.CreatedAt = time.Now()
+	created := *v
+	repo.verifications = append(repo.verifications, &created)
+	return nil
+}
+
+func (repo *fakeRepo) LatestVerification(ctx context.Context, pUUID string) (player.Verification, bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	v := repo.latest(pUUID)
+	if v == nil {
+		return player.Verification{}, false, nil
+	}
+	return repo.withEmails(*v), true, nil
+}
+
+func (repo *fakeRepo) Verification(ctx context.Context, pUUID string, vID uint64) (player.Verification, bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID == vID && v.PlayerUUID == pUUID {
+			return repo.withEmails(*v), true, nil
+		}
+	}
+	return player.Verification{}, false, nil
+}
+
+func (repo *fakeRepo) CreateManualVerification(ctx context.Context, v *player.Verification) error {
+	now := time.Now()
+	v.Method = player.MethodManual
+	v.VerifiedAt = &now
+	return repo.CreateVerification(ctx, v)
+}
+
+func (repo *fakeRepo) RevokeVerification(ctx context.Context, vID uint64, by string, onBehalfOf string, reason string) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID == vID && v.RevokedAt == nil {
+			now := time.Now()
+			v.RevokedAt, v.RevokedBy, v.RevokedOnBehalfOf, v.RevokeReason = &now, by, onBehalfOf, reason
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (repo *fakeRepo) CreateEmailVerification(ctx context.Context, ve player.VerificationEmail) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID == ve.VerificationID {
+			ve.CreatedAt = time.Now()
+			v.Emails = append(v.Emails, ve)
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) DeleteEmailVerification(ctx context.Context, vID uint64, code string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID != vID {
+			continue
+		}
+		for i, e := range v.Emails {
+			if e.Code == code {
+				v.Emails = append(v.Emails[:i], v.Emails[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) BounceVerificationEmail(ctx context.Context, messageID string, recipient string, reason string) (player.BouncedEmail, bool, error) {
+	return player.BouncedEmail{}, false, nil
+}
+
+func (repo *fakeRepo) ComplainVerificationEmail(ctx context.Context, messageID string, recipient string, feedbackType string) (player.BouncedEmail, bool, error) {
+	return player.BouncedEmail{}, false, nil
+}
+
+func (repo *fakeRepo) VerifyVerification(ctx context.Context, vID uint64, code string) (player.VerificationEmail, bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID != vID {
+			continue
+		}
+		for i, e := range v.Emails {
+			if e.Code == code {
+				now := time.Now()
+				v.Emails[i].VerifiedAt = &now
+				return v.Emails[i], true, nil
+			}
+		}
+	}
+	return player.VerificationEmail{}, false, nil
+}
+
+func (repo *fakeRepo) UnverifyVerification(ctx context.Context, vID uint64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, v := range repo.verifications {
+		if v.ID != vID {
+			continue
+		}
+		v.VerifiedAt, v.VerifiedBy, v.VerifiedOnBehalfOf = nil, "", ""
+		for i := range v.Emails {
+			v.Emails[i].VerifiedAt = nil
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) DeleteVerification(ctx context.Context, vID uint64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for i, v := range repo.verifications {
+		if v.ID == vID {
+			repo.verifications = append(repo.verifications[:i], repo.verifications[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (repo *fakeRepo) ExpireVerification(ctx context.Context, vID uint64) error {
+	return nil
+}
+
+func (repo *fakeRepo) ExpireVerifications(ctx context.Context, validity time.Duration, limit int) ([]player.Verification, error) {
+	return nil, nil
+}
+
+func (repo *fakeRepo) ClaimExpiryReminders(ctx context.Context, validity time.Duration, before time.Duration, limit int) ([]player.ExpiringVerification, error) {
+	return nil, nil
+}
+
+func (repo *fakeRepo) ReleaseExpiryReminder(ctx context.Context, vID uint64) error {
+	return nil
+}
+
+// fakeMailer records the sent codes and fails with the queued errors.
+// limited are returned by CheckRateLimit, failures by sends. If verified
+// is set, the addresses of verified emails are sent to it.
+type fakeMailer struct {
+	mu       sync.Mutex
+	codes    []string
+	locales  []string
+	limited  []error
+	failures []error
+	verified chan string
+}
+
+func (m *fakeMailer) NewMessageID() (string, error) {
+	return "<test@example.com>", nil
+}
+
+func (m *fakeMailer) CheckRateLimit(recipients ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.limited) > 0 {
+		err := m.limited[0]
+		m.limited = m.limited[1:]
+		return err
+	}
+	return nil
+}
+
+func (m *fakeMailer) SendVerificationEmail(ctx context.Context, data mailer.VerificationEmailData, sendTo ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.failures) > 0 {
+		err := m.failures[0]
+		m.failures = m.failures[1:]
+		return err
+	}
+	m.codes = append(m.codes, data.Code)
+	m.locales = append(m.locales, data.Locale)
+	return nil
+}
+
+func (m *fakeMailer) lastCode() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.codes[len(m.codes)-1]
+}
+
+func (m *fakeMailer) SendVerifiedEmail(ctx context.Context, data mailer.VerifiedEmailData, sendTo ...string) error {
+	if m.verified != nil {
+		m.verified <- data.Email
+	}
+	return nil
+}
+
+func (m *fakeMailer) SendExpiryReminderEmail(ctx context.Context, data mailer.ExpiryReminderEmailData, sendTo ...string) error {
+	return nil
+}
+
+func (m *fakeMailer) SendRevokedEmail(ctx context.Context, data mailer.RevokedEmailData, sendTo ...string) error {
+	return nil
+}
+
+type testEnv struct {
+	repo   *fakeRepo
+	mail   *fakeMailer
+	svc    *player.Service
+	client *client.Client
+	url    string
+	// requests counts the requests that reached the server.
+	requests int
+	mu       sync.Mutex
+}
+
+func (env *testEnv) requestCount() int {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return env.requests
+}
+
+// newTestEnv serves the real router with fake dependencies. wrap may
+// put a handler in front of the router.
+func newTestEnv(t *testing.T, wrap func(http.Handler) http.Handler) *testEnv {
+	t.Helper()
+
+	env := &testEnv{repo: newFakeRepo(), mail: &fakeMailer{}}
+	svc := &player.Service{
+		Repo:   env.repo,
+		Mailer: env.mail,
+		Config: func() player.VerificationEmailConfig {
+			return player.VerificationEmailConfig{
+				EmailRegex:             regexp.MustCompile(`@example\.com$`),
+				VerificationCodeLength: 6,
+				EmailValidityDuration:  time.Hour,
+				MaxEmailTries:          2,
+			}
+		},
+	}
+	env.svc = svc
+	var handler http.Handler = httpapi.NewRouter(httpapi.Config{
+		Players:      svc,
+		Repo:         env.repo,
+		Keys:         func() []auth.Key { return []auth.Key{{Name: "test", Key: testKey, Scopes: []string{auth.ScopeAdmin}}} },
+		AuthRequired: func() bool { return true },
+	})
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.mu.Lock()
+		env.requests++
+		env.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	env.url = srv.URL
+	env.client = client.New(srv.URL, testKey)
+	env.client.RetryBackoff = time.Millisecond
+	env.client.MaxRetryBackoff = 5 * time.Second
+	return env
+}
+
+func (env *testEnv) createPlayer(t *testing.T) {
+	t.Helper()
+	if _, err := env.client.CreatePlayer(context.Background(), client.Player{UUID: testUUID, Username: "Steve"}); err != nil {
+		t.Fatalf("CreatePlayer: %v", err)
+	}
+}
+
+func TestPlayers(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	created, err := env.client.CreatePlayer(ctx, client.Player{UUID: testUUID, Username: "Steve"})
+	if err != nil {
+		t.Fatalf("CreatePlayer: %v", err)
+	}
+	if created.UUID != testUUID || created.Username != "Steve" || created.CreatedAt.IsZero() {
+		t.Errorf("CreatePlayer = %+v", created)
+	}
+
+	p, err := env.client.GetPlayer(ctx, testUUID)
+	if err != nil {
+		t.Fatalf("GetPlayer: %v", err)
+	}
+	if p.UUID != testUUID || p.Username != "Steve" || p.IsVerified {
+		t.Errorf("GetPlayer = %+v", p)
+	}
+
+	_, err = env.client.CreatePlayer(ctx, client.Player{UUID: testUUID, Username: "Steve"})
+	if !errors.Is(err, client.ErrPlayerExists) || !errors.Is(err, client.ErrConflict) {
+		t.Errorf("CreatePlayer of existing player = %v, want ErrPlayerExists", err)
+	}
+
+	_, err = env.client.CreatePlayer(ctx, client.Player{UUID: "invalid", Username: "Steve"})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("CreatePlayer with invalid UUID = %v, want ErrBadRequest", err)
+	}
+
+	_, err = env.client.GetPlayer(ctx, "0d6c1d2e-53a4-4f7a-9a3b-7b0a1c2d3e4f")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetPlayer of unknown player = %v, want ErrNotFound", err)
+	}
+}
+
+func TestVerification(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+
+	err := env.client.Verify(ctx, testUUID, "WRONG1")
+	if !errors.Is(err, client.ErrInvalidCode) || !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Verify with wrong code = %v, want ErrInvalidCode", err)
+	}
+
+	if err := env.client.Verify(ctx, testUUID, env.mail.lastCode()); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	verifications, err := env.client.ListVerifications(ctx, testUUID)
+	if err != nil {
+		t.Fatalf("ListVerifications: %v", err)
+	}
+	if len(verifications) != 1 || !verifications[0].IsVerified ||
+		len(verifications[0].Emails) != 1 || verifications[0].Emails[0].Email != "steve@example.com" {
+		t.Errorf("ListVerifications = %+v", verifications)
+	}
+
+	p, err := env.client.GetPlayer(ctx, testUUID)
+	if err != nil {
+		t.Fatalf("GetPlayer: %v", err)
+	}
+	if !p.IsVerified {
+		t.Error("player not verified")
+	}
+}
+
+func TestVerifiedNotificationInBackground(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	cfg := env.svc.Config()
+	cfg.Notifications.Verified = true
+	env.svc.Config = func() player.VerificationEmailConfig { return cfg }
+	env.mail.verified = make(chan string)
+
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+
+	// The mailer blocks until the email is received below, so Verify
+	// only returns if the notification is sent in the background.
+	verifyCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := env.client.Verify(verifyCtx, testUUID, env.mail.lastCode()); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	select {
+	case email := <-env.mail.verified:
+		if email != "steve@example.com" {
+			t.Errorf("verified email sent to %s, want steve@example.com", email)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("verified email not sent")
+	}
+	env.svc.Wait()
+}
+
+func TestSendVerificationEmailErrors(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	err := env.client.SendVerificationEmail(ctx, testUUID, "steve@elsewhere.com", "")
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("SendVerificationEmail with invalid address = %v, want ErrBadRequest", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+			t.Fatalf("SendVerificationEmail: %v", err)
+		}
+	}
+	err = env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", "")
+	if !errors.Is(err, client.ErrMaxEmailTries) || !errors.Is(err, client.ErrConflict) {
+		t.Errorf("SendVerificationEmail after max tries = %v, want ErrMaxEmailTries", err)
+	}
+}
+
+func TestSendVerificationEmailManuallyVerified(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	v := player.Verification{PlayerUUID: testUUID, Reason: "known member"}
+	if err := env.repo.CreateManualVerification(ctx, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", "")
+	if !errors.Is(err, client.ErrAlreadyVerified) || !errors.Is(err, client.ErrConflict) {
+		t.Errorf("SendVerificationEmail when verified manually = %v, want ErrAlreadyVerified", err)
+	}
+	p, err := env.client.GetPlayer(ctx, testUUID)
+	if err != nil {
+		t.Fatalf("GetPlayer: %v", err)
+	}
+	if !p.IsVerified {
+		t.Error("player no longer verified")
+	}
+
+	// After revoking, the player can verify by email again.
+	if _, err := env.repo.RevokeVerification(ctx, v.ID, "admin", "", "left"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+		t.Errorf("SendVerificationEmail after revoking: %v", err)
+	}
+}
+
+func TestManualVerificationActor(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	body := strings.NewReader(`{"reason": "known member", "actor": "alice"}`)
+	req, err := http.NewRequest(http.MethodPost, env.url+"/players/"+testUUID+"/verifications/manual", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("manual verification status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	verifications, err := env.client.ListVerifications(ctx, testUUID)
+	if err != nil {
+		t.Fatalf("ListVerifications: %v", err)
+	}
+	if len(verifications) != 1 || verifications[0].VerifiedBy != "test" || verifications[0].VerifiedOnBehalfOf != "alice" {
+		t.Errorf("ListVerifications = %+v, want verified by the key on behalf of alice", verifications)
+	}
+}
+
+func TestSendVerificationEmailLocale(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", "en-GB"); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+		t.Fatalf("SendVerificationEmail without locale: %v", err)
+	}
+
+	env.mail.mu.Lock()
+	locales := env.mail.locales
+	env.mail.mu.Unlock()
+	if len(locales) != 2 || locales[0] != "en-GB" || locales[1] != "" {
+		t.Errorf("sent locales = %q, want [en-GB ]", locales)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.client.APIKey = ""
+
+	_, err := env.client.GetPlayer(context.Background(), testUUID)
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("GetPlayer without key = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	env.mail.failures = []error{&mailer.RateLimitError{Scope: "address", RetryAfter: time.Second}}
+	before := env.requestCount()
+	start := time.Now()
+	if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+		t.Fatalf("SendVerificationEmail: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want Retry-After of 1s", elapsed)
+	}
+	if n := env.requestCount() - before; n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+
+	// A Retry-After above MaxRetryBackoff is not cut short.
+	env.client.MaxRetryBackoff = 100 * time.Millisecond
+	env.mail.failures = []error{&mailer.RateLimitError{Scope: "address", RetryAfter: time.Second}}
+	before = env.requestCount()
+	start = time.Now()
+	err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", "")
+	if !errors.Is(err, client.ErrRateLimited) {
+		t.Errorf("SendVerificationEmail while rate limited = %v, want ErrRateLimited", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("returned after %s, want no retry", elapsed)
+	}
+	if n := env.requestCount() - before; n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestRateLimitedKeepsVerification(t *testing.T) {
+	ctx := context.Background()
+	rateLimited := &mailer.RateLimitError{Scope: "address", RetryAfter: time.Minute}
+
+	tests := []struct {
+		name string
+		// limit makes the next email rate limited.
+		limit func(m *fakeMailer)
+	}{
+		{"before_creating", func(m *fakeMailer) { m.limited = []error{rateLimited} }},
+		// Another email took the last token after the check.
+		{"while_sending", func(m *fakeMailer) { m.failures = []error{rateLimited} }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			env.client.MaxRetries = 0
+			env.createPlayer(t)
+			if err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", ""); err != nil {
+				t.Fatalf("SendVerificationEmail: %v", err)
+			}
+			if err := env.client.Verify(ctx, testUUID, env.mail.lastCode()); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+
+			// The verification is closed, so the next email
+			// starts a new one.
+			env.repo.mu.Lock()
+			env.repo.verifications[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+			env.repo.mu.Unlock()
+
+			test.limit(env.mail)
+			err := env.client.SendVerificationEmail(ctx, testUUID, "steve@example.com", "")
+			if !errors.Is(err, client.ErrRateLimited) {
+				t.Fatalf("SendVerificationEmail = %v, want ErrRateLimited", err)
+			}
+
+			verifications, err := env.client.ListVerifications(ctx, testUUID)
+			if err != nil {
+				t.Fatalf("ListVerifications: %v", err)
+			}
+			if len(verifications) != 1 {
+				t.Errorf("%d verifications, want 1", len(verifications))
+			}
+			p, err := env.client.GetPlayer(ctx, testUUID)
+			if err != nil {
+				t.Fatalf("GetPlayer: %v", err)
+			}
+			if !p.IsVerified {
+				t.Error("player no longer verified")
+			}
+		})
+	}
+}
+
+// unavailable responds with 503 and Retry-After to the first n requests,
+// like a proxy in front of a restarting server.
+func unavailable(n int) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			fail := n > 0
+			n--
+			mu.Unlock()
+			if fail {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRetryUnavailable(t *testing.T) {
+	env := newTestEnv(t, unavailable(1))
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := env.client.CreatePlayer(ctx, client.Player{UUID: testUUID, Username: "Steve"}); err != nil {
+		t.Fatalf("CreatePlayer: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want Retry-After of 1s", elapsed)
+	}
+	if n := env.requestCount(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestRetryServerError(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+	env.createPlayer(t)
+
+	env.repo.failures = 2
+	before := env.requestCount()
+	if _, err := env.client.GetPlayer(ctx, testUUID); err != nil {
+		t.Fatalf("GetPlayer: %v", err)
+	}
+	if n := env.requestCount() - before; n != 3 {
+		t.Errorf("GET sent %d requests, want 3", n)
+	}
+
+	env.repo.failures = 10
+	before = env.requestCount()
+	_, err := env.client.GetPlayer(ctx, testUUID)
+	if !errors.Is(err, client.ErrServer) {
+		t.Errorf("GetPlayer = %v, want ErrServer", err)
+	}
+	if n := env.requestCount() - before; n != env.client.MaxRetries+1 {
+		t.Errorf("GET sent %d requests, want %d", n, env.client.MaxRetries+1)
+	}
+}
+
+func TestNoPostRetryOnServerError(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.repo.failures = 1
+
+	_, err := env.client.CreatePlayer(context.Background(), client.Player{UUID: testUUID, Username: "Steve"})
+	if !errors.Is(err, client.ErrServer) {
+		t.Errorf("CreatePlayer = %v, want ErrServer", err)
+	}
+	if n := env.requestCount(); n != 1 {
+		t.Errorf("POST sent %d requests, want 1", n)
+	}
+	if env.repo.createCalls != 1 {
+		t.Errorf("CreatePlayer called %d times, want 1", env.repo.createCalls)
+	}
+}
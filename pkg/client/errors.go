@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors by status code. Every *Error matches one of them with errors.Is.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Errors of specific operations. They also match the error of their
+// status code, e.g. ErrPlayerExists matches ErrConflict.
+var (
+	ErrPlayerExists          = errors.New("player already exists")
+	ErrMaxEmailTries         = errors.New("max email tries reached")
+	ErrNoPendingVerification = errors.New("no pending verification")
+	ErrInvalidCode           = errors.New("invalid code")
+	ErrAlreadyRevoked        = errors.New("verification already revoked")
+	ErrAlreadyVerified       = errors.New("player already verified manually")
+)
+
+// messages maps the messages of the server to the errors of
+// specific operations.
+var messages = map[string]error{
+	"Max email tries reached":          ErrMaxEmailTries,
+	"No pending verification":          ErrNoPendingVerification,
+	"Invalid code":                     ErrInvalidCode,
+	"Verification already revoked":     ErrAlreadyRevoked,
+	"Player already verified manually": ErrAlreadyVerified,
+}
+
+// Error is returned for responses with a status code other than 2xx.
+type Error struct {
+	StatusCode int
+	// Message is the body of the response, if any.
+	Message string
+
+	op error
+}
+
+func newError(statusCode int, body []byte) *Error {
+	msg := strings.TrimSpace(string(body))
+	return &Error{
+		StatusCode: statusCode,
+		Message:    msg,
+		op:         messages[msg],
+	}
+}
+
+func (err *Error) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("mailverifier: %d %s", err.StatusCode, http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf("mailverifier: %d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+func (err *Error) status() error {
+	switch {
+	case err.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case err.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case err.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case err.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case err.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case err.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case err.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+func (err *Error) Is(target error) bool {
+	return target != nil && (target == err.op || target == err.status())
+}
@@ -0,0 +1,45 @@
+package client
+
+import "time"
+
+type Player struct {
+	UUID       string    `json:"uuid"`
+	Username   string    `json:"username"`
+	IsVerified bool      `json:"isVerified"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type Verification struct {
+	ID         uint64              `json:"id"`
+	PlayerUUID string              `json:"playerUuid,omitempty"`
+	Method     string              `json:"method"`
+	Emails     []VerificationEmail `json:"emails,omitempty"`
+	IsVerified bool                `json:"isVerified"`
+
+	Reason             string     `json:"reason,omitempty"`
+	VerifiedAt         *time.Time `json:"verifiedAt,omitempty"`
+	VerifiedBy         string     `json:"verifiedBy,omitempty"`
+	VerifiedOnBehalfOf string     `json:"verifiedOnBehalfOf,omitempty"`
+	RevokedAt          *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy          string     `json:"revokedBy,omitempty"`
+	RevokedOnBehalfOf  string     `json:"revokedOnBehalfOf,omitempty"`
+	RevokeReason       string     `json:"revokeReason,omitempty"`
+	ExpiredAt          *time.Time `json:"expiredAt,omitempty"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
+
+type VerificationEmail struct {
+	VerificationID uint64     `json:"verificationId"`
+	Email          string     `json:"email"`
+	VerifiedAt     *time.Time `json:"verifiedAt,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	// BouncedAt is set if the recipient's server rejected the email.
+	BouncedAt    *time.Time `json:"bouncedAt,omitempty"`
+	BounceReason string     `json:"bounceReason,omitempty"`
+	// ComplainedAt is set if the recipient reported the email as spam.
+	ComplainedAt  *time.Time `json:"complainedAt,omitempty"`
+	ComplaintType string     `json:"complaintType,omitempty"`
+	// Locale is the requested locale of the email.
+	Locale string `json:"locale,omitempty"`
+}